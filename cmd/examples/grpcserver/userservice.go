@@ -9,7 +9,9 @@ import (
 	"sync"
 
 	pb "github.com/eset/grpc-rest-proxy/cmd/examples/grpcserver/gen/user/v1"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -125,6 +127,12 @@ func (s *userService) CreateUser(ctx context.Context, request *pb.CreateUserRequ
 		Job:      request.User.Job,
 		Address:  request.User.Address,
 	})
+
+	// proxy responds with 201 Created and Location header
+	err := grpc.SetHeader(ctx, metadata.Pairs("x-http-code", "201", "x-http-location", "/api/user/"+request.User.Username))
+	if err != nil {
+		return nil, err
+	}
 	return &pb.GetUserResponse{
 		User: request.User,
 	}, nil
@@ -71,7 +71,7 @@ func createGateways(conf *Config) (*gateways, error) {
 }
 
 func (app *App) createHTTPServer() {
-	handler := transport.NewHandler(app.reloader)
+	handler := transport.NewHandler(app.reloader, app.conf.Transport.HTTP.StatusPath)
 	app.serverHTTP = http.NewServer(app.conf.Transport.HTTP.Server, handler)
 }
 
@@ -91,12 +91,24 @@ func (app *App) createProxyEndpoint(ctx context.Context) (*transport.ProxyEndpoi
 		return nil, jErrors.Annotate(jErrors.Trace(err), "failed to retrieve proto descriptors from source")
 	}
 
-	parseResult := protoparser.ParseFileDescSets(fileDescriptorSet)
+	// service configuration is read on each reload together with descriptors
+	parserOpts, err := protoparser.NewOptions(app.conf.Service.Routes)
+	if err != nil {
+		return nil, jErrors.Trace(err)
+	}
+
+	parseResult := protoparser.ParseFileDescSets(fileDescriptorSet, parserOpts)
 	if !parseResult.Ok() {
 		return nil, jErrors.Trace(jErrors.New(parseResult.ErrorsString()))
 	}
+	for _, warning := range parseResult.Warnings {
+		logging.Warn(warning.Error())
+	}
 
 	router := routerPkg.NewRouter()
+	if pathConf := app.conf.Transport.HTTP.PathNormalization; pathConf != nil && pathConf.CaseInsensitive {
+		router = routerPkg.NewCaseInsensitiveRouter()
+	}
 
 	for _, route := range parseResult.Routes {
 		err = router.Push(route)
@@ -108,12 +120,17 @@ func (app *App) createProxyEndpoint(ctx context.Context) (*transport.ProxyEndpoi
 
 	encoder := jsonencoder.New(app.conf.Service.JSONEncoder, parseResult.TypeResolver)
 
-	return transport.NewProxyEndpoint(
+	endpoint, err := transport.NewProxyEndpoint(
 		logging.Default(),
+		app.conf.Transport.HTTP,
 		router,
+		parseResult.Methods,
 		app.gateways.grpcClient,
 		encoder,
-	), nil
+		app.conf.Service.Cache,
+		app.conf.Service.Coalescing,
+	)
+	return endpoint, jErrors.Trace(err)
 }
 
 func (app *App) listenForSignal(ctx context.Context, sigUsr1 <-chan os.Signal) {
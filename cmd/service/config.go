@@ -9,7 +9,10 @@ import (
 
 	"github.com/eset/grpc-rest-proxy/pkg/gateway/grpc"
 	"github.com/eset/grpc-rest-proxy/pkg/repository/descriptors"
+	"github.com/eset/grpc-rest-proxy/pkg/service/cache"
+	"github.com/eset/grpc-rest-proxy/pkg/service/coalescer"
 	"github.com/eset/grpc-rest-proxy/pkg/service/jsonencoder"
+	"github.com/eset/grpc-rest-proxy/pkg/service/protoparser"
 	"github.com/eset/grpc-rest-proxy/pkg/transport"
 
 	"github.com/go-playground/validator/v10"
@@ -30,6 +33,9 @@ type Gateway struct {
 
 type Service struct {
 	JSONEncoder *jsonencoder.Config `mapstructure:"jsonencoder"`
+	Cache       *cache.Config       `mapstructure:"cache"`
+	Coalescing  *coalescer.Config   `mapstructure:"coalescing"`
+	Routes      *protoparser.Config `mapstructure:"routes"`
 }
 
 func (c *Config) validate() error {
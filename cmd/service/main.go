@@ -33,6 +33,21 @@ const (
 	defaultUseProtoNames           = false
 	defaultEmitUnpopulated         = false
 	defaultEmitDefaultValues       = false
+	defaultLimiterInitialLimit     = 100
+	defaultLimiterMinLimit         = 10
+	defaultLimiterMaxLimit         = 1000
+	defaultLimiterBackoffRatio     = 0.9
+	defaultBreakerFailures         = 5
+	defaultBreakerErrorRate        = 0.5
+	defaultBreakerMinRequests      = 20
+	defaultBreakerInterval         = time.Minute
+	defaultBreakerOpenTimeout      = 30 * time.Second
+	defaultBreakerHalfOpenRequests = 1
+	defaultCacheMaxEntries         = 10000
+	defaultCacheMaxSizeKB          = 102400
+	defaultCompressionMinSize      = 1024
+	defaultCompressionEncodings    = "gzip,zstd,deflate"
+	defaultContentTypes            = "application/json,application/x-protobuf"
 )
 
 var (
@@ -45,11 +60,29 @@ func main() {
 	conf := &Config{}
 
 	pflag.Uint("transport.http.maxRequestSizeKB", maxRequestSize, "maximum size of requests in KB")
+	pflag.Uint("transport.http.maxPartSizeKB", 0, "maximum size of a single part of multipart/form-data body in KB, unlimited when zero")
 	pflag.Duration("transport.http.requestTimeout", defaultRequestTimeout, "request timeout")
 	pflag.String("transport.http.server.addr", httpServerAddr, "address and port of the HTTP server")
 	pflag.Duration("transport.http.server.gracefulTimeout", defaultRequestTimeout, "graceful timeout")
 	pflag.Duration("transport.http.server.readTimeout", defaultReadTimeout, "read timeout")
 	pflag.Duration("transport.http.server.readHeaderTimeout", defaultRequestTimeout, "read header timeout")
+	pflag.Bool("transport.http.emptyAsNoContent", false, "send google.protobuf.Empty responses as 204 No Content")
+	pflag.String("transport.http.errorFormat", "status", "format of error responses (status, grpcGateway, problem)")
+	pflag.String("transport.http.fieldNaming", "both", "names of fields accepted in query parameters (both, proto, json)")
+	pflag.Bool("transport.http.hideErrorDetails", false, "hide details of invalid requests which may reveal internals of the service")
+	pflag.String("transport.http.pathNormalization.trailingSlash", "off", "handling of trailing slashes (off, rewrite, redirect)")
+	pflag.String("transport.http.pathNormalization.duplicateSlashes", "off", "handling of duplicate slashes (off, rewrite, redirect)")
+	pflag.String("transport.http.pathNormalization.dotSegments", "off", "handling of . and .. segments (off, rewrite, redirect)")
+	pflag.Bool("transport.http.pathNormalization.caseInsensitive", false, "match literal segments of routes regardless of case")
+	pflag.String("transport.http.queryParams", "strict", "handling of unknown query parameters (strict, lenient)")
+	pflag.String("transport.http.statusPath", "/status", "path of the health status endpoint, disabled when empty")
+	pflag.Bool("transport.http.rpc.grpcWeb", false, "accept gRPC-Web requests for all methods")
+	pflag.Bool("transport.http.rpc.connect", false, "accept Connect protocol requests for all methods")
+	pflag.StringArray("transport.http.contentTypes", strings.Split(defaultContentTypes, ","), "response content types by preference")
+	pflag.Bool("transport.http.compression.enabled", false, "enable compression of responses")
+	pflag.Uint("transport.http.compression.minSize", defaultCompressionMinSize, "minimal size of compressed responses in bytes")
+	pflag.StringArray("transport.http.compression.encodings", strings.Split(defaultCompressionEncodings, ","), "encodings by preference")
+	pflag.StringArray("transport.http.compression.contentTypes", nil, "content types of compressed responses (all when empty)")
 
 	pflag.String("descriptors.kind", defaultDescriptorsFetchingType, "type of descriptors fetching")
 	pflag.Duration("descriptors.remote.timeout", descriptorTimeout, "request timeout for remote descriptors")
@@ -61,10 +94,37 @@ func main() {
 	pflag.Duration("gateways.grpc.client.requestTimeout", defaultRequestTimeout, "requests timeout")
 	pflag.Bool("gateways.grpc.client.tls", tls, "use TLS for gRPC connection")
 	pflag.Bool("gateways.grpc.client.tlsSkipverify", tlsSkipverify, "skip TLS verification")
+	pflag.String("gateways.grpc.client.compression", "", "compression of gRPC requests (gzip)")
+	pflag.Bool("gateways.grpc.limiter.enabled", false, "enable adaptive concurrency limiting of upstream requests")
+	pflag.Bool("gateways.grpc.limiter.perMethod", false, "apply concurrency limit also per gRPC method")
+	pflag.Uint("gateways.grpc.limiter.initialLimit", defaultLimiterInitialLimit, "initial concurrency limit")
+	pflag.Uint("gateways.grpc.limiter.minLimit", defaultLimiterMinLimit, "minimal concurrency limit")
+	pflag.Uint("gateways.grpc.limiter.maxLimit", defaultLimiterMaxLimit, "maximal concurrency limit")
+	pflag.Float64("gateways.grpc.limiter.backoffRatio", defaultLimiterBackoffRatio, "ratio applied to the limit when upstream is overloaded")
+	pflag.Bool("gateways.grpc.circuitBreaker.enabled", false, "enable circuit breaker for upstream requests")
+	pflag.Uint("gateways.grpc.circuitBreaker.consecutiveFailures", defaultBreakerFailures, "failures which open the circuit breaker")
+	pflag.Float64("gateways.grpc.circuitBreaker.errorRateThreshold", defaultBreakerErrorRate, "error rate which opens the circuit breaker")
+	pflag.Uint("gateways.grpc.circuitBreaker.minRequests", defaultBreakerMinRequests, "requests needed to evaluate error rate")
+	pflag.Duration("gateways.grpc.circuitBreaker.interval", defaultBreakerInterval, "interval for clearing circuit breaker statistics")
+	pflag.Duration("gateways.grpc.circuitBreaker.openTimeout", defaultBreakerOpenTimeout, "time the circuit breaker stays open")
+	pflag.Uint("gateways.grpc.circuitBreaker.halfOpenRequests", defaultBreakerHalfOpenRequests, "probes needed to close the circuit breaker")
 
 	pflag.Bool("service.jsonencoder.useProtoNames", defaultUseProtoNames, "use proto names in JSON response (instead of camel case)")
 	pflag.Bool("service.jsonencoder.emitUnpopulated", defaultEmitUnpopulated, "emit unpopulated fields in JSON response for empty gRPC values")
 	pflag.Bool("service.jsonencoder.emitDefaultValues", defaultEmitDefaultValues, "include default values in JSON response for empty gRPC values") //nolint:lll
+	pflag.Bool("service.cache.enabled", false, "enable caching of GET responses")
+	pflag.Duration("service.cache.ttl", 0, "default time to live of cached responses")
+	pflag.Int("service.cache.maxEntries", defaultCacheMaxEntries, "maximum number of cached responses")
+	pflag.Uint("service.cache.maxSizeKB", defaultCacheMaxSizeKB, "maximum size of cached responses in KB")
+	pflag.StringArray("service.cache.headers", nil, "request headers which are part of the cache key in addition to Authorization and Cookie")
+	pflag.StringArray("service.cache.routes", nil, "route patterns or gRPC methods to cache (all GET routes when empty)")
+	pflag.Bool("service.coalescing.enabled", false, "enable coalescing of identical concurrent GET requests")
+	pflag.StringArray("service.coalescing.routes", nil, "route patterns or gRPC methods whose requests are coalesced")
+	pflag.StringArray("service.coalescing.headers", nil, "request headers which are part of the coalescing key in addition to Authorization and Cookie")
+	pflag.Bool("service.routes.autoRoutes.enabled", false, "create POST /{package.Service}/{Method} routes for methods without HTTP rules")
+	pflag.StringArray("service.routes.autoRoutes.services", nil, "services with automatic routes (all when empty)")
+	pflag.String("service.routes.serviceConfig", "", "path to google.api.Service YAML file with HTTP rules")
+	pflag.String("service.routes.precedence", "annotations", "rules used for annotated methods (annotations, serviceConfig, merge)")
 
 	pflag.BoolP("version", "v", false, "print version")
 	configFile := pflag.StringP("config", "c", "", "path to config file")
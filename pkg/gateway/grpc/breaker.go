@@ -0,0 +1,412 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	logging "log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	grpcStatus "google.golang.org/grpc/status"
+)
+
+var errCircuitOpen = grpcStatus.Error(codes.Unavailable, "circuit breaker is open")
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateHalfOpen
+	stateOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case stateClosed:
+		return "closed"
+	case stateHalfOpen:
+		return "half-open"
+	case stateOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// breakerCounts holds request statistics of the current state or interval.
+type breakerCounts struct {
+	requests             uint
+	failures             uint
+	successes            uint
+	consecutiveFailures  uint
+	consecutiveSuccesses uint
+}
+
+func (c *breakerCounts) onSuccess() {
+	c.successes++
+	c.consecutiveSuccesses++
+	c.consecutiveFailures = 0
+}
+
+func (c *breakerCounts) onFailure() {
+	c.failures++
+	c.consecutiveFailures++
+	c.consecutiveSuccesses = 0
+}
+
+// circuitBreaker is a state machine protecting single backend method.
+//
+// Closed breaker passes all requests and trips to open when consecutive failures or error rate reach
+// configured thresholds. Open breaker rejects all requests until open timeout elapses, then it becomes
+// half-open and lets limited number of probing requests through. Successful probes close the breaker,
+// any failed probe opens it again.
+type circuitBreaker struct {
+	cfg *CircuitBreakerConfig
+	now func() time.Time
+
+	onStateChange func(from, to breakerState)
+
+	mtx        sync.Mutex
+	state      breakerState
+	generation uint64
+	counts     breakerCounts
+	expiry     time.Time
+}
+
+func newCircuitBreaker(cfg *CircuitBreakerConfig, onStateChange func(from, to breakerState)) *circuitBreaker {
+	cb := &circuitBreaker{
+		cfg:           cfg,
+		now:           time.Now,
+		onStateChange: onStateChange,
+	}
+	cb.newGeneration(cb.now())
+	return cb
+}
+
+// allow checks whether a request can be sent. On success it returns generation which must be passed to done.
+func (cb *circuitBreaker) allow() (uint64, bool) {
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+
+	now := cb.now()
+	state := cb.currentState(now)
+
+	switch state {
+	case stateOpen:
+		return cb.generation, false
+	case stateHalfOpen:
+		if cb.counts.requests >= cb.cfg.HalfOpenRequests {
+			return cb.generation, false
+		}
+	case stateClosed:
+	}
+
+	cb.counts.requests++
+	return cb.generation, true
+}
+
+// done records result of request allowed in given generation. Results from previous generations are ignored.
+func (cb *circuitBreaker) done(generation uint64, failed bool) {
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+
+	now := cb.now()
+	state := cb.currentState(now)
+	if generation != cb.generation {
+		return
+	}
+
+	if failed {
+		cb.onFailure(state, now)
+	} else {
+		cb.onSuccess(state, now)
+	}
+}
+
+// release returns the request slot of abandoned request, e.g. cancelled by the client, without recording its result.
+func (cb *circuitBreaker) release(generation uint64) {
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+
+	cb.currentState(cb.now())
+	if generation == cb.generation && cb.counts.requests > 0 {
+		cb.counts.requests--
+	}
+}
+
+// finish records result of the request given by its error. Requests cancelled by the client or rejected by the proxy
+// itself, e.g. by concurrency limiter, say nothing about the backend and only release their slot.
+func (cb *circuitBreaker) finish(generation uint64, err error) {
+	if grpcStatus.Code(err) == codes.Canceled || isLocalRejection(err) {
+		cb.release(generation)
+		return
+	}
+	cb.done(generation, isBreakerFailure(err))
+}
+
+func (cb *circuitBreaker) onSuccess(state breakerState, now time.Time) {
+	cb.counts.onSuccess()
+
+	if state == stateHalfOpen && cb.counts.consecutiveSuccesses >= cb.cfg.HalfOpenRequests {
+		cb.setState(stateClosed, now)
+	}
+}
+
+func (cb *circuitBreaker) onFailure(state breakerState, now time.Time) {
+	cb.counts.onFailure()
+
+	switch state {
+	case stateClosed:
+		if cb.shouldTrip() {
+			cb.setState(stateOpen, now)
+		}
+	case stateHalfOpen:
+		cb.setState(stateOpen, now)
+	case stateOpen:
+	}
+}
+
+func (cb *circuitBreaker) shouldTrip() bool {
+	if cb.counts.consecutiveFailures >= cb.cfg.ConsecutiveFailures {
+		return true
+	}
+
+	if cb.cfg.ErrorRateThreshold <= 0 || cb.counts.requests < cb.cfg.MinRequests || cb.counts.requests == 0 {
+		return false
+	}
+	return float64(cb.counts.failures)/float64(cb.counts.requests) >= cb.cfg.ErrorRateThreshold
+}
+
+// currentState moves breaker to next state when current state expired.
+func (cb *circuitBreaker) currentState(now time.Time) breakerState {
+	switch cb.state {
+	case stateClosed:
+		if !cb.expiry.IsZero() && !cb.expiry.After(now) {
+			cb.newGeneration(now)
+		}
+	case stateOpen:
+		if !cb.expiry.After(now) {
+			cb.setState(stateHalfOpen, now)
+		}
+	case stateHalfOpen:
+	}
+	return cb.state
+}
+
+func (cb *circuitBreaker) setState(state breakerState, now time.Time) {
+	if cb.state == state {
+		return
+	}
+
+	prev := cb.state
+	cb.state = state
+	cb.newGeneration(now)
+
+	if cb.onStateChange != nil {
+		cb.onStateChange(prev, state)
+	}
+}
+
+func (cb *circuitBreaker) newGeneration(now time.Time) {
+	cb.generation++
+	cb.counts = breakerCounts{}
+
+	switch cb.state {
+	case stateClosed:
+		if cb.cfg.Interval > 0 {
+			cb.expiry = now.Add(cb.cfg.Interval)
+		} else {
+			cb.expiry = time.Time{}
+		}
+	case stateOpen:
+		cb.expiry = now.Add(cb.cfg.OpenTimeout)
+	case stateHalfOpen:
+		cb.expiry = time.Time{}
+	}
+}
+
+type breakerMetrics struct {
+	state       *prometheus.GaugeVec
+	transitions *prometheus.CounterVec
+	rejected    *prometheus.CounterVec
+}
+
+func newBreakerMetrics() *breakerMetrics {
+	m := &breakerMetrics{
+		state: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "grpc_rest_proxy_circuit_breaker_state",
+			Help: "Current state of the circuit breaker (0 - closed, 1 - half-open, 2 - open).",
+		}, []string{"backend", "method"}),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_rest_proxy_circuit_breaker_transitions_total",
+			Help: "Number of circuit breaker state transitions.",
+		}, []string{"backend", "method", "from", "to"}),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_rest_proxy_circuit_breaker_rejected_total",
+			Help: "Number of requests rejected by the circuit breaker.",
+		}, []string{"backend", "method"}),
+	}
+	prometheus.MustRegister(m.state, m.transitions, m.rejected)
+	return m
+}
+
+// circuitBreakers keeps one circuit breaker for each gRPC method of the backend.
+type circuitBreakers struct {
+	cfg     *CircuitBreakerConfig
+	backend string
+	metrics *breakerMetrics
+
+	mtx      sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func newCircuitBreakers(cfg *CircuitBreakerConfig, backend string, metrics *breakerMetrics) *circuitBreakers {
+	return &circuitBreakers{
+		cfg:      cfg,
+		backend:  backend,
+		metrics:  metrics,
+		breakers: make(map[string]*circuitBreaker),
+	}
+}
+
+func (c *circuitBreakers) get(method string) *circuitBreaker {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	cb, ok := c.breakers[method]
+	if !ok {
+		cb = newCircuitBreaker(c.cfg, func(from, to breakerState) {
+			c.stateChanged(method, from, to)
+		})
+		c.breakers[method] = cb
+	}
+	return cb
+}
+
+func (c *circuitBreakers) stateChanged(method string, from, to breakerState) {
+	logging.Warn("circuit breaker state changed",
+		"backend", c.backend, "method", method, "from", from.String(), "to", to.String())
+
+	if c.metrics == nil {
+		return
+	}
+	c.metrics.state.WithLabelValues(c.backend, method).Set(float64(to))
+	c.metrics.transitions.WithLabelValues(c.backend, method, from.String(), to.String()).Inc()
+}
+
+func (c *circuitBreakers) reject(method string) error {
+	if c.metrics != nil {
+		c.metrics.rejected.WithLabelValues(c.backend, method).Inc()
+	}
+	return errCircuitOpen
+}
+
+func (c *circuitBreakers) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		cb := c.get(method)
+		generation, ok := cb.allow()
+		if !ok {
+			return c.reject(method)
+		}
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		cb.finish(generation, err)
+		return err
+	}
+}
+
+func (c *circuitBreakers) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		cb := c.get(method)
+		generation, ok := cb.allow()
+		if !ok {
+			return nil, c.reject(method)
+		}
+
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			cb.finish(generation, err)
+			return nil, err
+		}
+
+		bs := &breakerStream{ClientStream: stream, finish: func(err error) { cb.finish(generation, err) }}
+		go bs.watchContext()
+		return bs, nil
+	}
+}
+
+// breakerStream reports result of the stream to the circuit breaker once the first message or error is received,
+// or once the stream fails or ends before that.
+type breakerStream struct {
+	grpc.ClientStream
+	once   sync.Once
+	finish func(err error)
+}
+
+func (s *breakerStream) report(err error) {
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	s.once.Do(func() { s.finish(err) })
+}
+
+// watchContext reports the stream when its context is done, e.g. the stream was cancelled before receiving.
+func (s *breakerStream) watchContext() {
+	ctx := s.Context()
+	<-ctx.Done()
+	s.report(grpcStatus.FromContextError(ctx.Err()).Err())
+}
+
+func (s *breakerStream) Header() (metadata.MD, error) {
+	md, err := s.ClientStream.Header()
+	if err != nil {
+		s.report(err)
+	}
+	return md, err
+}
+
+func (s *breakerStream) CloseSend() error {
+	err := s.ClientStream.CloseSend()
+	if err != nil {
+		s.report(err)
+	}
+	return err
+}
+
+func (s *breakerStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	s.report(err)
+	return err
+}
+
+// isBreakerFailure reports whether error means that upstream is unavailable.
+func isBreakerFailure(err error) bool {
+	switch grpcStatus.Code(err) { //nolint:exhaustive
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
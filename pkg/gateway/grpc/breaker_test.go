@@ -0,0 +1,202 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	grpcStatus "google.golang.org/grpc/status"
+)
+
+func newTestBreaker(cfg *CircuitBreakerConfig) (*circuitBreaker, *time.Time, *[]breakerState) {
+	now := time.Unix(0, 0)
+	var transitions []breakerState
+	cb := newCircuitBreaker(cfg, func(_, to breakerState) {
+		transitions = append(transitions, to)
+	})
+	cb.now = func() time.Time { return now }
+	cb.newGeneration(now)
+	return cb, &now, &transitions
+}
+
+func call(t *testing.T, cb *circuitBreaker, failed bool) {
+	t.Helper()
+	generation, ok := cb.allow()
+	require.True(t, ok)
+	cb.done(generation, failed)
+}
+
+func TestCircuitBreakerConsecutiveFailures(t *testing.T) {
+	cb, now, transitions := newTestBreaker(&CircuitBreakerConfig{
+		ConsecutiveFailures: 3,
+		OpenTimeout:         time.Second,
+		HalfOpenRequests:    2,
+	})
+
+	call(t, cb, true)
+	call(t, cb, true)
+	call(t, cb, false)
+	call(t, cb, true)
+	call(t, cb, true)
+	require.Empty(t, *transitions, "failures are not consecutive")
+
+	call(t, cb, true)
+	require.Equal(t, []breakerState{stateOpen}, *transitions)
+
+	_, ok := cb.allow()
+	require.False(t, ok, "open breaker rejects requests")
+
+	*now = now.Add(time.Second)
+	firstProbe, ok := cb.allow()
+	require.True(t, ok)
+	secondProbe, ok := cb.allow()
+	require.True(t, ok)
+	_, ok = cb.allow()
+	require.False(t, ok, "half-open breaker limits number of probes")
+	require.Equal(t, []breakerState{stateOpen, stateHalfOpen}, *transitions)
+
+	cb.done(firstProbe, false)
+	cb.done(secondProbe, false)
+	require.Equal(t, []breakerState{stateOpen, stateHalfOpen, stateClosed}, *transitions)
+	call(t, cb, false)
+}
+
+func TestCircuitBreakerFailedProbe(t *testing.T) {
+	cb, now, transitions := newTestBreaker(&CircuitBreakerConfig{
+		ConsecutiveFailures: 1,
+		OpenTimeout:         time.Second,
+		HalfOpenRequests:    1,
+	})
+
+	staleGeneration, ok := cb.allow()
+	require.True(t, ok)
+	call(t, cb, true)
+
+	*now = now.Add(time.Second)
+	call(t, cb, true)
+	require.Equal(t, []breakerState{stateOpen, stateHalfOpen, stateOpen}, *transitions)
+
+	cb.done(staleGeneration, false)
+	_, ok = cb.allow()
+	require.False(t, ok, "result from previous generation must be ignored")
+}
+
+func TestCircuitBreakerErrorRate(t *testing.T) {
+	cb, now, transitions := newTestBreaker(&CircuitBreakerConfig{
+		ConsecutiveFailures: 100,
+		ErrorRateThreshold:  0.5,
+		MinRequests:         4,
+		Interval:            time.Minute,
+		OpenTimeout:         time.Second,
+		HalfOpenRequests:    1,
+	})
+
+	call(t, cb, true)
+	call(t, cb, false)
+	call(t, cb, true)
+	require.Empty(t, *transitions, "not enough requests")
+
+	*now = now.Add(time.Minute)
+	call(t, cb, false)
+	require.Empty(t, *transitions, "statistics are cleared after interval")
+
+	call(t, cb, true)
+	call(t, cb, false)
+	call(t, cb, true)
+	require.Equal(t, []breakerState{stateOpen}, *transitions)
+}
+
+type testClientStream struct {
+	grpc.ClientStream
+	ctx       context.Context
+	headerErr error
+}
+
+func (s *testClientStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *testClientStream) Header() (metadata.MD, error) {
+	return nil, s.headerErr
+}
+
+func TestBreakerStream(t *testing.T) {
+	breakers := newCircuitBreakers(&CircuitBreakerConfig{
+		ConsecutiveFailures: 1,
+		HalfOpenRequests:    1,
+	}, "test", nil)
+	interceptor := breakers.StreamClientInterceptor()
+	cb := breakers.get("/test.v1.TestService/Watch")
+
+	openStream := func(stream grpc.ClientStream, err error) (grpc.ClientStream, error) {
+		return interceptor(context.Background(), &grpc.StreamDesc{}, nil, "/test.v1.TestService/Watch",
+			func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+				return stream, err
+			})
+	}
+	pendingRequests := func() uint {
+		cb.mtx.Lock()
+		defer cb.mtx.Unlock()
+		return cb.counts.requests
+	}
+	state := func() breakerState {
+		cb.mtx.Lock()
+		defer cb.mtx.Unlock()
+		return cb.state
+	}
+
+	_, err := openStream(nil, grpcStatus.Error(codes.Unavailable, ""))
+	require.Error(t, err)
+	require.Equal(t, stateOpen, state())
+
+	// probe cancelled before receiving gives its slot back
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = openStream(&testClientStream{ctx: ctx}, nil)
+	require.NoError(t, err)
+	require.Equal(t, stateHalfOpen, state())
+	require.Equal(t, uint(1), pendingRequests())
+	cancel()
+	require.Eventually(t, func() bool { return pendingRequests() == 0 }, time.Second, time.Millisecond)
+
+	// failure of header is reported
+	stream, err := openStream(&testClientStream{ctx: context.Background(), headerErr: grpcStatus.Error(codes.Unavailable, "")}, nil)
+	require.NoError(t, err)
+	_, err = stream.Header()
+	require.Error(t, err)
+	require.Equal(t, stateOpen, state())
+}
+
+func TestCircuitBreakerLocalRejection(t *testing.T) {
+	cb, now, transitions := newTestBreaker(&CircuitBreakerConfig{
+		ConsecutiveFailures: 1,
+		OpenTimeout:         time.Second,
+		HalfOpenRequests:    1,
+	})
+
+	call(t, cb, true)
+	*now = now.Add(time.Second)
+
+	probe, ok := cb.allow()
+	require.True(t, ok)
+	cb.finish(probe, errConcurrencyLimitExceeded)
+	require.Equal(t, []breakerState{stateOpen, stateHalfOpen}, *transitions, "rejected probe does not close the breaker")
+
+	probe, ok = cb.allow()
+	require.True(t, ok, "rejected probe gives its slot back")
+	cb.finish(probe, nil)
+	require.Equal(t, []breakerState{stateOpen, stateHalfOpen, stateClosed}, *transitions)
+
+	generation, ok := cb.allow()
+	require.True(t, ok)
+	cb.finish(generation, errConcurrencyLimitExceeded)
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+	require.Equal(t, breakerCounts{}, cb.counts, "local rejection is not recorded")
+}
@@ -12,6 +12,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	_ "google.golang.org/grpc/encoding/gzip" // registers gzip compressor
 
 	jErrors "github.com/juju/errors"
 )
@@ -37,11 +38,28 @@ func NewClient(c *ClientConfig) (ClientInterface, error) {
 		transportCreds = insecure.NewCredentials()
 	}
 
-	metricInterceptor := createClientMetricsInterceptor()
+	var unaryInterceptors []grpc.UnaryClientInterceptor
+	var streamInterceptors []grpc.StreamClientInterceptor
+	// breaker is outside of the limiter, so requests rejected by open breaker never count as overload of the backend
+	if c.CircuitBreaker != nil && c.CircuitBreaker.Enabled {
+		breakers := newCircuitBreakers(c.CircuitBreaker, c.Config.TargetAddr, newBreakerMetrics())
+		unaryInterceptors = append(unaryInterceptors, breakers.UnaryClientInterceptor())
+		streamInterceptors = append(streamInterceptors, breakers.StreamClientInterceptor())
+	}
+	if c.Limiter != nil && c.Limiter.Enabled {
+		limiter := newConcurrencyLimiter(c.Limiter, c.Config.TargetAddr, newLimiterMetrics())
+		unaryInterceptors = append(unaryInterceptors, limiter.UnaryClientInterceptor())
+	}
+	unaryInterceptors = append(unaryInterceptors, createClientMetricsInterceptor())
 
 	dialOpts = append(dialOpts,
 		grpc.WithTransportCredentials(transportCreds),
-		grpc.WithUnaryInterceptor(metricInterceptor))
+		grpc.WithChainUnaryInterceptor(unaryInterceptors...),
+		grpc.WithChainStreamInterceptor(streamInterceptors...))
+
+	if c.Config.Compression != "" {
+		dialOpts = append(dialOpts, grpc.WithDefaultCallOptions(grpc.UseCompressor(c.Config.Compression)))
+	}
 
 	grpcClient, err := grpc.NewClient(c.Config.TargetAddr, dialOpts...)
 	if err != nil {
@@ -8,8 +8,10 @@ import (
 )
 
 type ClientConfig struct {
-	RequestTimeout time.Duration `mapstructure:"requestTimeout" validate:"gt=100ms"`
-	Config         *Config       `mapstructure:"client" validate:"required"`
+	RequestTimeout time.Duration         `mapstructure:"requestTimeout" validate:"gt=100ms"`
+	Config         *Config               `mapstructure:"client" validate:"required"`
+	Limiter        *LimiterConfig        `mapstructure:"limiter"`
+	CircuitBreaker *CircuitBreakerConfig `mapstructure:"circuitBreaker"`
 }
 
 type Config struct {
@@ -17,4 +19,33 @@ type Config struct {
 	RequestTimeout time.Duration `mapstructure:"requestTimeout" validate:"gt=100ms"`
 	TLS            bool          `mapstructure:"tls"`
 	TLSSkipVerify  bool          `mapstructure:"tlsSkipverify"`
+	// compression of requests sent to the upstream, empty disables compression
+	Compression string `mapstructure:"compression" validate:"omitempty,oneof=gzip"`
+}
+
+// LimiterConfig configures adaptive (AIMD) concurrency limiting of requests sent to the upstream.
+type LimiterConfig struct {
+	Enabled      bool    `mapstructure:"enabled"`
+	PerMethod    bool    `mapstructure:"perMethod"`
+	InitialLimit uint    `mapstructure:"initialLimit" validate:"gtefield=MinLimit,ltefield=MaxLimit"`
+	MinLimit     uint    `mapstructure:"minLimit" validate:"gt=0"`
+	MaxLimit     uint    `mapstructure:"maxLimit" validate:"gtefield=MinLimit"`
+	BackoffRatio float64 `mapstructure:"backoffRatio" validate:"gt=0,lt=1"`
+}
+
+// CircuitBreakerConfig configures circuit breaker kept for each gRPC method of the backend.
+type CircuitBreakerConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// number of consecutive Unavailable or DeadlineExceeded responses which opens the breaker
+	ConsecutiveFailures uint `mapstructure:"consecutiveFailures" validate:"gt=0"`
+	// ratio of failed requests in interval which opens the breaker, zero disables the check
+	ErrorRateThreshold float64 `mapstructure:"errorRateThreshold" validate:"gte=0,lte=1"`
+	// minimal number of requests in interval before error rate is evaluated
+	MinRequests uint `mapstructure:"minRequests"`
+	// interval after which statistics of closed breaker are cleared, zero means never
+	Interval time.Duration `mapstructure:"interval" validate:"gte=0"`
+	// how long the breaker stays open before it lets probing requests through
+	OpenTimeout time.Duration `mapstructure:"openTimeout" validate:"gt=0"`
+	// number of successful probing requests needed to close half-open breaker
+	HalfOpenRequests uint `mapstructure:"halfOpenRequests" validate:"gt=0"`
 }
@@ -0,0 +1,231 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package grpc
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcStatus "google.golang.org/grpc/status"
+)
+
+// backendScope is used as method label for the limiter shared by all methods of a backend.
+const backendScope = "*"
+
+var errConcurrencyLimitExceeded = grpcStatus.Error(codes.Unavailable, "concurrency limit exceeded")
+
+// aimdLimiter caps number of in-flight requests. The limit grows additively on successful
+// requests and shrinks multiplicatively when upstream signals overload.
+type aimdLimiter struct {
+	mtx      sync.Mutex
+	limit    float64
+	inFlight uint
+
+	minLimit     float64
+	maxLimit     float64
+	backoffRatio float64
+}
+
+func newAIMDLimiter(cfg *LimiterConfig) *aimdLimiter {
+	return &aimdLimiter{
+		limit:        float64(cfg.InitialLimit),
+		minLimit:     float64(cfg.MinLimit),
+		maxLimit:     float64(cfg.MaxLimit),
+		backoffRatio: cfg.BackoffRatio,
+	}
+}
+
+func (l *aimdLimiter) acquire() bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if float64(l.inFlight) >= l.limit {
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+func (l *aimdLimiter) release(dropped bool) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	inFlight := l.inFlight
+	l.inFlight--
+
+	if dropped {
+		l.limit = max(l.minLimit, l.limit*l.backoffRatio)
+		return
+	}
+
+	// grow only when the limit is actually being used, otherwise an idle backend would reach maximum
+	if float64(inFlight)*2 >= l.limit {
+		l.limit = min(l.maxLimit, l.limit+1/l.limit)
+	}
+}
+
+// cancel returns slot which was acquired but not used for a request.
+func (l *aimdLimiter) cancel() {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.inFlight--
+}
+
+func (l *aimdLimiter) state() (limit float64, inFlight uint) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.limit, l.inFlight
+}
+
+type limiterMetrics struct {
+	limit    *prometheus.GaugeVec
+	inFlight *prometheus.GaugeVec
+	shed     *prometheus.CounterVec
+}
+
+func newLimiterMetrics() *limiterMetrics {
+	labels := []string{"backend", "method"}
+	m := &limiterMetrics{
+		limit: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "grpc_rest_proxy_limiter_limit",
+			Help: "Current concurrency limit toward the upstream.",
+		}, labels),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "grpc_rest_proxy_limiter_in_flight",
+			Help: "Number of in-flight requests toward the upstream.",
+		}, labels),
+		shed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_rest_proxy_limiter_shed_total",
+			Help: "Number of requests rejected because the concurrency limit was reached.",
+		}, labels),
+	}
+	prometheus.MustRegister(m.limit, m.inFlight, m.shed)
+	return m
+}
+
+// concurrencyLimiter keeps one limiter for the whole backend and optionally one for each gRPC method.
+type concurrencyLimiter struct {
+	cfg     *LimiterConfig
+	backend string
+	metrics *limiterMetrics
+
+	backendLimiter *aimdLimiter
+
+	mtx            sync.Mutex
+	methodLimiters map[string]*aimdLimiter
+}
+
+func newConcurrencyLimiter(cfg *LimiterConfig, backend string, metrics *limiterMetrics) *concurrencyLimiter {
+	return &concurrencyLimiter{
+		cfg:            cfg,
+		backend:        backend,
+		metrics:        metrics,
+		backendLimiter: newAIMDLimiter(cfg),
+		methodLimiters: make(map[string]*aimdLimiter),
+	}
+}
+
+func (c *concurrencyLimiter) methodLimiter(method string) *aimdLimiter {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	limiter, ok := c.methodLimiters[method]
+	if !ok {
+		limiter = newAIMDLimiter(c.cfg)
+		c.methodLimiters[method] = limiter
+	}
+	return limiter
+}
+
+// acquire reserves a slot for the method. Returned function must be called once the request is finished.
+func (c *concurrencyLimiter) acquire(method string) (func(dropped bool), bool) {
+	if !c.backendLimiter.acquire() {
+		c.shed(backendScope)
+		return nil, false
+	}
+
+	if !c.cfg.PerMethod {
+		c.report(backendScope, c.backendLimiter)
+		return func(dropped bool) {
+			c.backendLimiter.release(dropped)
+			c.report(backendScope, c.backendLimiter)
+		}, true
+	}
+
+	methodLimiter := c.methodLimiter(method)
+	if !methodLimiter.acquire() {
+		c.backendLimiter.cancel()
+		c.report(backendScope, c.backendLimiter)
+		c.shed(method)
+		return nil, false
+	}
+
+	c.report(backendScope, c.backendLimiter)
+	c.report(method, methodLimiter)
+	return func(dropped bool) {
+		methodLimiter.release(dropped)
+		c.backendLimiter.release(dropped)
+		c.report(method, methodLimiter)
+		c.report(backendScope, c.backendLimiter)
+	}, true
+}
+
+func (c *concurrencyLimiter) shed(method string) {
+	if c.metrics == nil {
+		return
+	}
+	c.metrics.shed.WithLabelValues(c.backend, method).Inc()
+}
+
+func (c *concurrencyLimiter) report(method string, limiter *aimdLimiter) {
+	if c.metrics == nil {
+		return
+	}
+	limit, inFlight := limiter.state()
+	c.metrics.limit.WithLabelValues(c.backend, method).Set(limit)
+	c.metrics.inFlight.WithLabelValues(c.backend, method).Set(float64(inFlight))
+}
+
+func (c *concurrencyLimiter) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		release, ok := c.acquire(method)
+		if !ok {
+			return errConcurrencyLimitExceeded
+		}
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		release(isOverloadError(err))
+		return err
+	}
+}
+
+// isLocalRejection reports whether request was rejected by the proxy without reaching the backend.
+func isLocalRejection(err error) bool {
+	return errors.Is(err, errCircuitOpen) || errors.Is(err, errConcurrencyLimitExceeded)
+}
+
+// isOverloadError reports whether error returned by upstream signals it cannot keep up with the load.
+func isOverloadError(err error) bool {
+	if isLocalRejection(err) {
+		return false
+	}
+
+	switch grpcStatus.Code(err) { //nolint:exhaustive
+	case codes.DeadlineExceeded, codes.Unavailable, codes.ResourceExhausted:
+		return true
+	default:
+		return false
+	}
+}
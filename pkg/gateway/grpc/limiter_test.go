@@ -0,0 +1,90 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package grpc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	grpcStatus "google.golang.org/grpc/status"
+)
+
+func TestAIMDLimiter(t *testing.T) {
+	limiter := newAIMDLimiter(&LimiterConfig{InitialLimit: 2, MinLimit: 1, MaxLimit: 3, BackoffRatio: 0.5})
+
+	require.True(t, limiter.acquire())
+	require.True(t, limiter.acquire())
+	require.False(t, limiter.acquire(), "limit reached")
+
+	limiter.release(false)
+	limit, inFlight := limiter.state()
+	require.InDelta(t, 2.5, limit, 0.001)
+	require.Equal(t, uint(1), inFlight)
+
+	limiter.release(true)
+	limit, inFlight = limiter.state()
+	require.InDelta(t, 1.25, limit, 0.001)
+	require.Equal(t, uint(0), inFlight)
+
+	for range 3 {
+		require.True(t, limiter.acquire())
+		limiter.release(true)
+	}
+	limit, _ = limiter.state()
+	require.InDelta(t, 1, limit, 0.001, "limit must not drop under minimum")
+
+	require.True(t, limiter.acquire())
+	limiter.release(false)
+	limit, _ = limiter.state()
+	require.InDelta(t, 2, limit, 0.001)
+
+	for range 100 {
+		require.True(t, limiter.acquire())
+		limiter.release(false)
+	}
+	limit, _ = limiter.state()
+	require.Less(t, limit, 3.0, "limit must not grow when it is not used")
+
+	for range 100 {
+		require.True(t, limiter.acquire())
+		require.True(t, limiter.acquire())
+		limiter.release(false)
+		limiter.release(false)
+	}
+	limit, _ = limiter.state()
+	require.InDelta(t, 3, limit, 0.001, "limit must not grow over maximum")
+}
+
+func TestConcurrencyLimiterPerMethod(t *testing.T) {
+	limiter := newConcurrencyLimiter(&LimiterConfig{
+		PerMethod: true, InitialLimit: 1, MinLimit: 1, MaxLimit: 1, BackoffRatio: 0.5,
+	}, "backend", nil)
+	limiter.backendLimiter.limit = 2
+
+	release, ok := limiter.acquire("/a.Service/A")
+	require.True(t, ok)
+
+	_, ok = limiter.acquire("/a.Service/A")
+	require.False(t, ok, "method limit reached")
+
+	releaseB, ok := limiter.acquire("/a.Service/B")
+	require.True(t, ok)
+
+	_, ok = limiter.acquire("/a.Service/C")
+	require.False(t, ok, "backend limit reached")
+
+	release(false)
+	releaseB(false)
+	_, inFlight := limiter.backendLimiter.state()
+	require.Equal(t, uint(0), inFlight)
+}
+
+func TestIsOverloadError(t *testing.T) {
+	require.True(t, isOverloadError(grpcStatus.Error(codes.Unavailable, "")))
+	require.True(t, isOverloadError(grpcStatus.Error(codes.DeadlineExceeded, "")))
+	require.False(t, isOverloadError(grpcStatus.Error(codes.NotFound, "")))
+	require.False(t, isOverloadError(nil))
+	require.False(t, isOverloadError(errCircuitOpen), "breaker rejection is not overload of the backend")
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eset/grpc-rest-proxy/pkg/service/transformer"
+
+	jErrors "github.com/juju/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	headerCacheControl = "Cache-Control"
+	headerSetCookie    = "Set-Cookie"
+	etagLength         = 32
+)
+
+type Config struct {
+	Enabled bool `mapstructure:"enabled"`
+	// default time to live, used when backend does not send cache-control metadata; zero disables the default
+	TTL        time.Duration `mapstructure:"ttl" validate:"gte=0"`
+	MaxEntries int           `mapstructure:"maxEntries" validate:"gte=0"`
+	MaxSizeKB  uint          `mapstructure:"maxSizeKB"`
+	// request headers which are part of the cache key in addition to Authorization and Cookie
+	Headers []string `mapstructure:"headers"`
+	// route patterns or gRPC methods which are cached, all GET routes are cached when empty
+	Routes []string `mapstructure:"routes"`
+}
+
+type Entry struct {
+	Header  http.Header
+	Body    []byte
+	ETag    string
+	expires time.Time
+}
+
+func NewEntry(header http.Header, body []byte) *Entry {
+	hash := sha256.Sum256(body)
+	return &Entry{
+		Header: header.Clone(),
+		Body:   body,
+		ETag:   strconv.Quote(hex.EncodeToString(hash[:])[:etagLength]),
+	}
+}
+
+func (e *Entry) size() int {
+	size := len(e.Body)
+	for name, values := range e.Header {
+		size += len(name)
+		for _, value := range values {
+			size += len(value)
+		}
+	}
+	return size
+}
+
+type item struct {
+	key   string
+	entry *Entry
+}
+
+// Cache is a size bounded LRU cache of encoded responses.
+type Cache struct {
+	conf       *Config
+	keyHeaders []string
+	maxSize    int
+	now        func() time.Time
+
+	mtx   sync.Mutex
+	lru   *list.List
+	items map[string]*list.Element
+	size  int
+}
+
+func New(conf *Config) *Cache {
+	return &Cache{
+		conf:       conf,
+		keyHeaders: transformer.GetRequestKeyHeaders(conf.Headers),
+		maxSize:    int(conf.MaxSizeKB) * 1024, //nolint:mnd
+		now:        time.Now,
+		lru:        list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// IsCacheable reports whether responses of the route identified by pattern and gRPC method can be cached.
+func (c *Cache) IsCacheable(pattern, grpcMethod string) bool {
+	if len(c.conf.Routes) == 0 {
+		return true
+	}
+	return slices.Contains(c.conf.Routes, pattern) || slices.Contains(c.conf.Routes, grpcMethod)
+}
+
+// Key builds cache key from gRPC method, request message, credentials and configured request headers.
+func (c *Cache) Key(grpcMethod string, request proto.Message, header http.Header) (string, error) {
+	key, err := transformer.GetRequestKey(grpcMethod, request, header, c.keyHeaders)
+	return key, jErrors.Trace(err)
+}
+
+// TTL returns how long response with given headers can be cached. Responses setting cookies are never cached.
+func (c *Cache) TTL(header http.Header) (time.Duration, bool) {
+	if len(header.Values(headerSetCookie)) > 0 {
+		return 0, false
+	}
+
+	ttl := c.conf.TTL
+
+	for _, directive := range strings.Split(header.Get(headerCacheControl), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache", "private":
+			return 0, false
+		case "max-age", "s-maxage":
+			seconds, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return 0, false
+			}
+			ttl = time.Duration(seconds) * time.Second
+		}
+	}
+
+	return ttl, ttl > 0
+}
+
+func (c *Cache) Get(key string) (*Entry, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	it := elem.Value.(*item) //nolint:errcheck,forcetypeassert
+	if !it.entry.expires.After(c.now()) {
+		c.remove(elem)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+	return it.entry, true
+}
+
+func (c *Cache) Set(key string, entry *Entry, ttl time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	entry.expires = c.now().Add(ttl)
+	entrySize := entry.size()
+	if c.maxSize > 0 && entrySize > c.maxSize {
+		return
+	}
+
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem)
+	}
+
+	c.items[key] = c.lru.PushFront(&item{key: key, entry: entry})
+	c.size += entrySize
+
+	for c.overLimit() {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *Cache) overLimit() bool {
+	if c.conf.MaxEntries > 0 && c.lru.Len() > c.conf.MaxEntries {
+		return true
+	}
+	return c.maxSize > 0 && c.size > c.maxSize
+}
+
+func (c *Cache) remove(elem *list.Element) {
+	it := c.lru.Remove(elem).(*item) //nolint:errcheck,forcetypeassert
+	delete(c.items, it.key)
+	c.size -= it.entry.size()
+}
+
+// MatchETag reports whether value of If-None-Match header matches the entity tag.
+func MatchETag(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package cache_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	userpb "github.com/eset/grpc-rest-proxy/cmd/examples/grpcserver/gen/user/v1"
+	"github.com/eset/grpc-rest-proxy/pkg/service/cache"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheEviction(t *testing.T) {
+	c := cache.New(&cache.Config{MaxEntries: 2})
+
+	c.Set("a", cache.NewEntry(nil, []byte("a")), time.Minute)
+	c.Set("b", cache.NewEntry(nil, []byte("b")), time.Minute)
+	_, ok := c.Get("a")
+	require.True(t, ok)
+
+	c.Set("c", cache.NewEntry(nil, []byte("c")), time.Minute)
+	_, ok = c.Get("b")
+	require.False(t, ok, "least recently used entry must be evicted")
+	_, ok = c.Get("a")
+	require.True(t, ok)
+	_, ok = c.Get("c")
+	require.True(t, ok)
+
+	c.Set("expired", cache.NewEntry(nil, []byte("expired")), -time.Second)
+	_, ok = c.Get("expired")
+	require.False(t, ok)
+}
+
+func TestCacheMaxSize(t *testing.T) {
+	c := cache.New(&cache.Config{MaxSizeKB: 1})
+
+	c.Set("big", cache.NewEntry(nil, make([]byte, 2048)), time.Minute)
+	_, ok := c.Get("big")
+	require.False(t, ok, "entry larger than cache must not be stored")
+
+	c.Set("a", cache.NewEntry(nil, make([]byte, 600)), time.Minute)
+	c.Set("b", cache.NewEntry(nil, make([]byte, 600)), time.Minute)
+	_, ok = c.Get("a")
+	require.False(t, ok)
+	_, ok = c.Get("b")
+	require.True(t, ok)
+}
+
+func TestCacheTTL(t *testing.T) {
+	c := cache.New(&cache.Config{TTL: time.Minute})
+
+	ttl, ok := c.TTL(http.Header{})
+	require.True(t, ok)
+	require.Equal(t, time.Minute, ttl)
+
+	ttl, ok = c.TTL(http.Header{"Cache-Control": []string{"public, max-age=10"}})
+	require.True(t, ok)
+	require.Equal(t, 10*time.Second, ttl)
+
+	_, ok = c.TTL(http.Header{"Cache-Control": []string{"no-store"}})
+	require.False(t, ok)
+
+	_, ok = cache.New(&cache.Config{}).TTL(http.Header{})
+	require.False(t, ok, "no default TTL")
+
+	_, ok = c.TTL(http.Header{"Cache-Control": []string{"max-age=10"}, "Set-Cookie": []string{"session=1"}})
+	require.False(t, ok, "responses setting cookies are never cached")
+}
+
+func TestCacheKey(t *testing.T) {
+	c := cache.New(&cache.Config{Headers: []string{"Authorization"}})
+	request := &userpb.GetUserRequest{Username: "John"}
+
+	key1, err := c.Key("/user.v1.UserService/GetUser", request, http.Header{"Authorization": []string{"a"}})
+	require.NoError(t, err)
+	key2, err := c.Key("/user.v1.UserService/GetUser", request, http.Header{"Authorization": []string{"b"}})
+	require.NoError(t, err)
+	key3, err := c.Key("/user.v1.UserService/GetUser", request, http.Header{"Authorization": []string{"a"}, "Other": []string{"x"}})
+	require.NoError(t, err)
+
+	require.NotEqual(t, key1, key2)
+	require.Equal(t, key1, key3)
+
+	// credentials are part of the key even when no headers are configured
+	c = cache.New(&cache.Config{})
+	for _, name := range []string{"Authorization", "Cookie"} {
+		key1, err = c.Key("/user.v1.UserService/GetUser", request, http.Header{name: []string{"a"}})
+		require.NoError(t, err)
+		key2, err = c.Key("/user.v1.UserService/GetUser", request, http.Header{name: []string{"b"}})
+		require.NoError(t, err)
+		require.NotEqual(t, key1, key2, name)
+	}
+}
+
+func TestMatchETag(t *testing.T) {
+	entry := cache.NewEntry(nil, []byte("body"))
+
+	require.True(t, cache.MatchETag(entry.ETag, entry.ETag))
+	require.True(t, cache.MatchETag(`"other", W/`+entry.ETag, entry.ETag))
+	require.True(t, cache.MatchETag("*", entry.ETag))
+	require.False(t, cache.MatchETag(`"other"`, entry.ETag))
+	require.False(t, cache.MatchETag("", entry.ETag))
+}
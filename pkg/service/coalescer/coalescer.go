@@ -0,0 +1,106 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package coalescer
+
+import (
+	"fmt"
+	"runtime/debug"
+	"slices"
+	"sync"
+
+	"github.com/eset/grpc-rest-proxy/pkg/service/transformer"
+)
+
+type Config struct {
+	Enabled bool `mapstructure:"enabled"`
+	// route patterns or gRPC methods whose identical concurrent GET requests are coalesced
+	Routes []string `mapstructure:"routes"`
+	// request headers which are part of the coalescing key in addition to Authorization and Cookie
+	Headers []string `mapstructure:"headers"`
+}
+
+// PanicError is returned to all callers sharing execution which panicked.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("coalesced call panicked: %v\n%s", e.Value, e.Stack)
+}
+
+type call[T any] struct {
+	wg  sync.WaitGroup
+	val T
+	err error
+}
+
+// Group collapses concurrent calls with the same key into a single execution.
+type Group[T any] struct {
+	conf       *Config
+	keyHeaders []string
+	// called when caller joins execution in flight, used by tests
+	onJoin func(key string)
+
+	mtx   sync.Mutex
+	calls map[string]*call[T]
+}
+
+func New[T any](conf *Config) *Group[T] {
+	return &Group[T]{
+		conf:       conf,
+		keyHeaders: transformer.GetRequestKeyHeaders(conf.Headers),
+		calls:      make(map[string]*call[T]),
+	}
+}
+
+// IsEligible reports whether requests of the route identified by pattern and gRPC method can be coalesced.
+func (g *Group[T]) IsEligible(pattern, grpcMethod string) bool {
+	return slices.Contains(g.conf.Routes, pattern) || slices.Contains(g.conf.Routes, grpcMethod)
+}
+
+// Headers returns request headers which have to be part of the coalescing key, credentials are always included,
+// so the execution is never shared among clients with different credentials.
+func (g *Group[T]) Headers() []string {
+	return g.keyHeaders
+}
+
+// Do executes fn unless there is an execution with the same key in flight, in which case it waits
+// for its result. Returned flag reports whether the result was shared with other callers. Panic of fn
+// is recovered and returned to all callers as *PanicError.
+func (g *Group[T]) Do(key string, fn func() T) (T, bool, error) {
+	g.mtx.Lock()
+	if c, ok := g.calls[key]; ok {
+		if g.onJoin != nil {
+			g.onJoin(key)
+		}
+		g.mtx.Unlock()
+		c.wg.Wait()
+		return c.val, true, c.err
+	}
+
+	c := &call[T]{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mtx.Unlock()
+
+	defer func() {
+		g.mtx.Lock()
+		delete(g.calls, key)
+		g.mtx.Unlock()
+		c.wg.Done()
+	}()
+
+	g.execute(c, fn)
+	return c.val, false, c.err
+}
+
+func (g *Group[T]) execute(c *call[T], fn func() T) {
+	defer func() {
+		if value := recover(); value != nil {
+			c.err = &PanicError{Value: value, Stack: debug.Stack()}
+		}
+	}()
+	c.val = fn()
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package coalescer_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/eset/grpc-rest-proxy/pkg/service/coalescer"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupDo(t *testing.T) {
+	const waiters = 10
+
+	group := coalescer.New[int](&coalescer.Config{})
+	joined := make(chan struct{}, waiters)
+	coalescer.SetOnJoin(group, func(string) { joined <- struct{}{} })
+
+	var calls, sharedCalls atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	results := make([]int, waiters)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0], _, _ = group.Do("key", func() int {
+			calls.Add(1)
+			close(started)
+			<-release
+			return 42
+		})
+	}()
+	<-started
+
+	for i := 1; i < waiters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var shared bool
+			results[i], shared, _ = group.Do("key", func() int {
+				calls.Add(1)
+				return 0
+			})
+			if shared {
+				sharedCalls.Add(1)
+			}
+		}()
+	}
+
+	other, shared, err := group.Do("other", func() int { return 1 })
+	require.NoError(t, err)
+	require.False(t, shared)
+	require.Equal(t, 1, other)
+
+	// all waiters joined the call in flight
+	for i := 1; i < waiters; i++ {
+		<-joined
+	}
+	close(release)
+	wg.Wait()
+
+	require.Equal(t, int32(1), calls.Load())
+	require.Equal(t, int32(waiters-1), sharedCalls.Load())
+	for _, result := range results {
+		require.Equal(t, 42, result)
+	}
+
+	result, shared, err := group.Do("key", func() int { return 7 })
+	require.NoError(t, err)
+	require.False(t, shared, "finished call must not be shared")
+	require.Equal(t, 7, result)
+}
+
+func TestGroupDoPanic(t *testing.T) {
+	group := coalescer.New[*int](&coalescer.Config{})
+	joined := make(chan struct{})
+	coalescer.SetOnJoin(group, func(string) { close(joined) })
+
+	started := make(chan struct{})
+	var wg sync.WaitGroup
+	var waiterErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-started
+		_, _, waiterErr = group.Do("key", func() *int { return nil })
+	}()
+
+	result, shared, err := group.Do("key", func() *int {
+		close(started)
+		<-joined
+		panic("upstream failure")
+	})
+	wg.Wait()
+
+	var panicErr *coalescer.PanicError
+	require.ErrorAs(t, err, &panicErr)
+	require.Equal(t, "upstream failure", panicErr.Value)
+	require.False(t, shared)
+	require.Nil(t, result)
+	require.ErrorAs(t, waiterErr, &panicErr, "waiters get the panic as error")
+}
+
+func TestGroupHeaders(t *testing.T) {
+	group := coalescer.New[int](&coalescer.Config{Headers: []string{"authorization", "Accept-Language"}})
+	require.Equal(t, []string{"Authorization", "Cookie", "Accept-Language"}, group.Headers())
+}
+
+func TestGroupIsEligible(t *testing.T) {
+	group := coalescer.New[int](&coalescer.Config{Routes: []string{"/api/users/{username}", "/user.v1.UserService/GetUser"}})
+
+	require.True(t, group.IsEligible("/api/users/{username}", "/user.v1.UserService/GetUsers"))
+	require.True(t, group.IsEligible("/api/user/{username}", "/user.v1.UserService/GetUser"))
+	require.False(t, group.IsEligible("/api/users/filter", "/user.v1.UserService/FilterUsers"))
+}
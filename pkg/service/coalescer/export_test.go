@@ -0,0 +1,9 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package coalescer
+
+// SetOnJoin sets function called when caller joins execution in flight.
+func SetOnJoin[T any](g *Group[T], onJoin func(key string)) {
+	g.onJoin = onJoin
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package protoparser
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	jErrors "github.com/juju/errors"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/genproto/googleapis/api/serviceconfig"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"gopkg.in/yaml.v3"
+)
+
+// Precedence decides which HTTP rules are used for method having both annotation and rule of service configuration.
+type Precedence string
+
+const (
+	// AnnotationsPrecedence uses annotation of the method and ignores the rule of service configuration
+	AnnotationsPrecedence Precedence = "annotations"
+	// ServiceConfigPrecedence uses rule of service configuration and ignores the annotation
+	ServiceConfigPrecedence Precedence = "serviceConfig"
+	// MergePrecedence creates routes of both annotation and rule of service configuration
+	MergePrecedence Precedence = "merge"
+)
+
+type Config struct {
+	AutoRoutes *AutoRoutesConfig `mapstructure:"autoRoutes"`
+	// path to google.api.Service YAML file whose HTTP rules are bound to methods by selector
+	ServiceConfig string     `mapstructure:"serviceConfig"`
+	Precedence    Precedence `mapstructure:"precedence" validate:"omitempty,oneof=annotations serviceConfig merge"`
+	// path prefixes of routes, the first mount matching the service is used
+	Mounts []*MountConfig `mapstructure:"mounts" validate:"dive"`
+}
+
+// MountConfig mounts routes of services under path prefix, e.g. routes of billing.v1.* under /api/billing.
+type MountConfig struct {
+	Prefix string `mapstructure:"prefix" validate:"required,startswith=/"`
+	// full names of services or their glob patterns, e.g. billing.v1.*
+	Services []string `mapstructure:"services" validate:"required,min=1"`
+}
+
+type AutoRoutesConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// full names of services which get automatic routes, all services when empty
+	Services []string `mapstructure:"services"`
+}
+
+// Options control how routes are created for parsed methods. Nil options create routes from HTTP annotations only.
+type Options struct {
+	AutoRoutes *AutoRoutesConfig
+	// HTTP rules of service configuration bound to methods by selector
+	Rules []*annotations.HttpRule
+	// precedence of rules for annotated methods, annotations are used when empty
+	Precedence Precedence
+	// path prefixes of routes of services
+	Mounts []*MountConfig
+}
+
+// NewOptions creates parser options from config, service configuration file is read when set.
+func NewOptions(conf *Config) (*Options, error) {
+	if conf == nil {
+		return nil, nil
+	}
+
+	for _, mount := range conf.Mounts {
+		for _, pattern := range mount.Services {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, jErrors.Annotatef(err, "invalid service pattern %s of mount %s", pattern, mount.Prefix)
+			}
+		}
+	}
+
+	opts := &Options{AutoRoutes: conf.AutoRoutes, Precedence: conf.Precedence, Mounts: conf.Mounts}
+	if conf.ServiceConfig == "" {
+		return opts, nil
+	}
+
+	service, err := LoadServiceConfig(conf.ServiceConfig)
+	if err != nil {
+		return nil, jErrors.Trace(err)
+	}
+	opts.Rules = service.GetHttp().GetRules()
+	return opts, nil
+}
+
+// LoadServiceConfig reads google.api.Service configuration from YAML file.
+// Unknown fields are ignored, so complete service configurations can be used.
+func LoadServiceConfig(path string) (*serviceconfig.Service, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, jErrors.Trace(err)
+	}
+
+	// YAML is converted to JSON which is the canonical encoding of the message
+	var content map[string]any
+	if err = yaml.Unmarshal(data, &content); err != nil {
+		return nil, jErrors.Annotatef(err, "failed to parse service config %s", path)
+	}
+	jsonData, err := json.Marshal(content)
+	if err != nil {
+		return nil, jErrors.Trace(err)
+	}
+
+	service := &serviceconfig.Service{}
+	if err = (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(jsonData, service); err != nil {
+		return nil, jErrors.Annotatef(err, "failed to decode service config %s", path)
+	}
+	return service, nil
+}
+
+func (o *Options) precedence() Precedence {
+	if o == nil || o.Precedence == "" {
+		return AnnotationsPrecedence
+	}
+	return o.Precedence
+}
+
+// mountPrefix returns path prefix of routes of the service without trailing slash, empty when it is not mounted.
+func (o *Options) mountPrefix(service protoreflect.ServiceDescriptor) string {
+	if o == nil {
+		return ""
+	}
+
+	for _, mount := range o.Mounts {
+		for _, pattern := range mount.Services {
+			if ok, _ := path.Match(pattern, string(service.FullName())); ok {
+				return strings.TrimSuffix(mount.Prefix, "/")
+			}
+		}
+	}
+	return ""
+}
+
+func (o *Options) hasAutoRoute(method protoreflect.MethodDescriptor) bool {
+	if o == nil || o.AutoRoutes == nil || !o.AutoRoutes.Enabled {
+		return false
+	}
+	// REST routes cannot carry streams
+	if method.IsStreamingClient() || method.IsStreamingServer() {
+		return false
+	}
+
+	services := o.AutoRoutes.Services
+	return len(services) == 0 || slices.Contains(services, string(method.Parent().FullName()))
+}
+
+// createAutoRule creates rule POST /{package.Service}/{Method} with whole request message in body.
+func createAutoRule(method protoreflect.MethodDescriptor) *annotations.HttpRule {
+	return &annotations.HttpRule{
+		Selector: string(method.FullName()),
+		Pattern: &annotations.HttpRule_Post{
+			Post: "/" + string(method.Parent().FullName()) + "/" + string(method.Name()),
+		},
+		Body: "*",
+	}
+}
@@ -17,19 +17,41 @@ import (
 	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/dynamicpb"
-	"google.golang.org/protobuf/types/known/anypb"
-	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-func ParseFileDescSets(fdSets []*descriptorpb.FileDescriptorSet) ParseResult {
+// ParseFileDescSets registers all types of file descriptor sets and creates routes of their methods.
+// Options are optional, routes are created from HTTP annotations only when nil.
+func ParseFileDescSets(fdSets []*descriptorpb.FileDescriptorSet, opts *Options) ParseResult {
 	result := ParseResult{
 		FileRegistry: &protoregistry.Files{},
 		TypeResolver: &protoregistry.Types{},
+		Methods:      make(map[string]*router.GrpcSpec),
+		options:      opts,
+		rules:        make(map[string]*annotations.HttpRule),
+		boundRules:   make(map[string]bool),
 	}
 
-	// Register default types.
-	registerFile(anypb.File_google_protobuf_any_proto, &result)
-	registerFile(timestamppb.File_google_protobuf_timestamp_proto, &result)
+	if opts != nil {
+		for _, rule := range opts.Rules {
+			if !isValidSelector(rule.GetSelector()) {
+				result.AddError(jErrors.Errorf("invalid HTTP rule selector %s", rule.GetSelector()))
+				continue
+			}
+			if _, ok := result.rules[rule.GetSelector()]; ok {
+				result.AddError(jErrors.Errorf("duplicate HTTP rule for selector %s", rule.GetSelector()))
+				continue
+			}
+			result.rules[rule.GetSelector()] = rule
+		}
+	}
+
+	// Register well-known types, so they are available even when backend does not provide them.
+	for _, fd := range wellKnownFiles {
+		registerFile(fd, &result)
+		if err := registerTypes(fd, &result); err != nil {
+			result.AddError(jErrors.Trace(err))
+		}
+	}
 
 	fileDescriptors := SortByDependencies(fdSets)
 
@@ -37,6 +59,13 @@ func ParseFileDescSets(fdSets []*descriptorpb.FileDescriptorSet) ParseResult {
 		parseFileDescSet(fileDesc, &result)
 	}
 
+	// service configuration may cover more services than the backend currently provides
+	for selector := range result.rules {
+		if !result.boundRules[selector] {
+			result.AddWarning(jErrors.Errorf("HTTP rule selector %s does not match any method", selector))
+		}
+	}
+
 	return result
 }
 
@@ -115,55 +144,67 @@ func getAdditionalBindings(httpOption *annotations.HttpRule) []*annotations.Http
 	return bindings
 }
 
-func createRoute(rule *annotations.HttpRule, fullname string, method protoreflect.MethodDescriptor) (*router.Route, error) {
-	methodType, pattern, err := getPattern(rule)
+func createGrpcSpec(method protoreflect.MethodDescriptor) (*router.GrpcSpec, error) {
+	rpcService, rpcMethod, err := ParseServiceNameAndMethod(string(method.FullName()))
 	if err != nil {
 		return nil, jErrors.Trace(err)
 	}
 
-	rpcService, rpcMethod, err := ParseServiceNameAndMethod(fullname)
+	return &router.GrpcSpec{
+		RequestDesc:     method.Input(),
+		ResponseDesc:    method.Output(),
+		Service:         rpcService,
+		Method:          rpcMethod,
+		ClientStreaming: method.IsStreamingClient(),
+		ServerStreaming: method.IsStreamingServer(),
+	}, nil
+}
+
+// createRoute creates route of the rule, pattern is mounted under prefix when it is not empty.
+func createRoute(rule *annotations.HttpRule, spec *router.GrpcSpec, prefix string) (*router.Route, error) {
+	methodType, pattern, err := getPattern(rule)
 	if err != nil {
 		return nil, jErrors.Trace(err)
 	}
 
-	route := router.NewRoute(pattern, rule.GetBody(), methodType, &router.GrpcSpec{
-		RequestDesc:  method.Input(),
-		ResponseDesc: method.Output(),
-		Service:      rpcService,
-		Method:       rpcMethod,
-	})
-	return route, nil
+	switch {
+	case prefix == "":
+	case pattern == "/":
+		pattern = prefix
+	default:
+		pattern = prefix + pattern
+	}
+
+	return router.NewRoute(pattern, rule.GetBody(), methodType, spec), nil
 }
 
 func parseServiceDesc(service protoreflect.ServiceDescriptor, result *ParseResult) {
 	methods := service.Methods()
+	prefix := result.options.mountPrefix(service)
 
 	for m := 0; m < methods.Len(); m++ {
 		method := methods.Get(m)
-		fullname := string(method.FullName())
-		methodOpts, ok := method.Options().(*descriptorpb.MethodOptions)
-		if !ok {
-			result.AddError(jErrors.Trace(jErrors.New("cannot convert method options to Method Options")))
+		spec, err := createGrpcSpec(method)
+		if err != nil {
+			result.AddError(jErrors.Trace(err))
 			continue
 		}
+		result.AddMethod(spec)
 
-		if !proto.HasExtension(methodOpts, annotations.E_Http) {
+		rootRules, err := getHTTPRules(method, result)
+		if err != nil {
+			result.AddError(jErrors.Trace(err))
 			continue
 		}
 
-		httpOption, ok := proto.GetExtension(methodOpts, annotations.E_Http).(*annotations.HttpRule)
-		if !ok {
-			result.AddError(jErrors.Trace(jErrors.New("cannot convert extension to HttpRule")))
-			continue
+		var httpRules []*annotations.HttpRule
+		for _, rootRule := range rootRules {
+			httpRules = append(httpRules, rootRule)
+			httpRules = append(httpRules, getAdditionalBindings(rootRule)...)
 		}
 
-		httpRules := []*annotations.HttpRule{httpOption}
-
-		additionalBindings := getAdditionalBindings(httpOption)
-		httpRules = append(httpRules, additionalBindings...)
-
 		for _, rule := range httpRules {
-			route, err := createRoute(rule, fullname, method)
+			route, err := createRoute(rule, spec, prefix)
 			if err != nil {
 				result.AddError(jErrors.Trace(err))
 				continue
@@ -173,6 +214,84 @@ func parseServiceDesc(service protoreflect.ServiceDescriptor, result *ParseResul
 	}
 }
 
+// getHTTPRules returns HTTP rules of the method. When the method has both annotation and rule of service
+// configuration, configured precedence decides which of them is used. Automatic rule is used for methods
+// without any of them. Empty result means no route.
+func getHTTPRules(method protoreflect.MethodDescriptor, result *ParseResult) ([]*annotations.HttpRule, error) {
+	methodOpts, ok := method.Options().(*descriptorpb.MethodOptions)
+	if !ok {
+		return nil, jErrors.New("cannot convert method options to Method Options")
+	}
+
+	selector, configRule, hasConfigRule := findRule(method, result.rules)
+	if hasConfigRule {
+		result.boundRules[selector] = true
+	}
+
+	if !proto.HasExtension(methodOpts, annotations.E_Http) {
+		if hasConfigRule {
+			return []*annotations.HttpRule{configRule}, nil
+		}
+		if result.options.hasAutoRoute(method) {
+			return []*annotations.HttpRule{createAutoRule(method)}, nil
+		}
+		return nil, nil
+	}
+
+	httpOption, ok := proto.GetExtension(methodOpts, annotations.E_Http).(*annotations.HttpRule)
+	if !ok {
+		return nil, jErrors.New("cannot convert extension to HttpRule")
+	}
+	if !hasConfigRule {
+		return []*annotations.HttpRule{httpOption}, nil
+	}
+
+	switch result.options.precedence() {
+	case ServiceConfigPrecedence:
+		return []*annotations.HttpRule{configRule}, nil
+	case MergePrecedence:
+		return []*annotations.HttpRule{httpOption, configRule}, nil
+	default:
+		return []*annotations.HttpRule{httpOption}, nil
+	}
+}
+
+// isValidSelector reports whether selector is full name of a method or a wildcard, which is allowed as the last
+// segment only, e.g. user.v1.UserService.* or *.
+func isValidSelector(selector string) bool {
+	name, wildcard := strings.CutSuffix(selector, "*")
+	if wildcard && name != "" && !strings.HasSuffix(name, ".") {
+		return false
+	}
+	return selector != "" && !strings.Contains(name, "*")
+}
+
+// findRule returns the rule whose selector matches full name of the method. Full name takes precedence over
+// wildcards and a longer wildcard takes precedence over a shorter one.
+func findRule(
+	method protoreflect.MethodDescriptor,
+	rules map[string]*annotations.HttpRule,
+) (string, *annotations.HttpRule, bool) {
+	name := string(method.FullName())
+	if rule, ok := rules[name]; ok {
+		return name, rule, true
+	}
+
+	for {
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+		if rule, ok := rules[name+".*"]; ok {
+			return name + ".*", rule, true
+		}
+	}
+
+	rule, ok := rules["*"]
+	return "*", rule, ok
+}
+
 func getPattern(rule *annotations.HttpRule) (router.MethodType, string, error) {
 	switch pattern := rule.GetPattern().(type) {
 	case *annotations.HttpRule_Get:
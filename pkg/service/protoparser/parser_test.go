@@ -6,13 +6,16 @@ package protoparser_test
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/eset/grpc-rest-proxy/pkg/service/protoparser"
 
 	jErrors "github.com/juju/errors"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/api/annotations"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/descriptorpb"
 	_ "google.golang.org/protobuf/types/known/anypb"
 	_ "google.golang.org/protobuf/types/known/timestamppb"
@@ -26,7 +29,7 @@ func TestProtoParser(t *testing.T) {
 	require.NoError(t, err)
 	require.NoError(t, proto.Unmarshal(protoFile, pbSet))
 
-	result := protoparser.ParseFileDescSets([]*descriptorpb.FileDescriptorSet{pbSet})
+	result := protoparser.ParseFileDescSets([]*descriptorpb.FileDescriptorSet{pbSet}, nil)
 
 	for _, route := range result.Routes {
 		fmt.Println(route.Path())
@@ -72,3 +75,186 @@ func TestParseServiceNameAndMethod(t *testing.T) {
 		require.Equal(t, route.Method, method)
 	}
 }
+
+func newUnannotatedFileDescSet() *descriptorpb.FileDescriptorSet {
+	return &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:        proto.String("test/v1/test.proto"),
+		Package:     proto.String("test.v1"),
+		Syntax:      proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{Name: proto.String("Request")}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("TestService"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{Name: proto.String("Get"), InputType: proto.String(".test.v1.Request"), OutputType: proto.String(".test.v1.Request")},
+				{Name: proto.String("List"), InputType: proto.String(".test.v1.Request"), OutputType: proto.String(".test.v1.Request")},
+			},
+		}},
+	}}}
+}
+
+func TestAutoRoutes(t *testing.T) {
+	fdSets := []*descriptorpb.FileDescriptorSet{newUnannotatedFileDescSet()}
+
+	result := protoparser.ParseFileDescSets(fdSets, nil)
+	require.True(t, result.Ok())
+	require.Empty(t, result.Routes)
+	require.Len(t, result.Methods, 2)
+
+	result = protoparser.ParseFileDescSets(fdSets, &protoparser.Options{
+		AutoRoutes: &protoparser.AutoRoutesConfig{Enabled: true, Services: []string{"test.v1.TestService"}},
+	})
+	require.True(t, result.Ok())
+	require.Len(t, result.Routes, 2)
+	require.Equal(t, "/test.v1.TestService/Get", result.Routes[0].Path())
+
+	result = protoparser.ParseFileDescSets(fdSets, &protoparser.Options{
+		AutoRoutes: &protoparser.AutoRoutesConfig{Enabled: true, Services: []string{"other.v1.OtherService"}},
+	})
+	require.True(t, result.Ok())
+	require.Empty(t, result.Routes)
+}
+
+func TestMounts(t *testing.T) {
+	_, err := protoparser.NewOptions(&protoparser.Config{
+		Mounts: []*protoparser.MountConfig{{Prefix: "/api", Services: []string{"test.v1.["}}},
+	})
+	require.Error(t, err)
+
+	opts, err := protoparser.NewOptions(&protoparser.Config{
+		AutoRoutes: &protoparser.AutoRoutesConfig{Enabled: true},
+		Mounts: []*protoparser.MountConfig{
+			{Prefix: "/api/other/", Services: []string{"other.v1.*"}},
+			{Prefix: "/api/test/", Services: []string{"test.v1.*"}},
+		},
+	})
+	require.NoError(t, err)
+
+	result := protoparser.ParseFileDescSets([]*descriptorpb.FileDescriptorSet{newUnannotatedFileDescSet()}, opts)
+	require.True(t, result.Ok())
+	require.Len(t, result.Routes, 2)
+	require.Equal(t, "/api/test/test.v1.TestService/Get", result.Routes[0].Path())
+}
+
+func TestServiceConfigRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+type: google.api.Service
+config_version: 3
+http:
+  rules:
+    - selector: test.v1.TestService.Get
+      get: /v1/test/{name}
+`), 0o600))
+
+	opts, err := protoparser.NewOptions(&protoparser.Config{
+		AutoRoutes:    &protoparser.AutoRoutesConfig{Enabled: true},
+		ServiceConfig: path,
+	})
+	require.NoError(t, err)
+	require.Len(t, opts.Rules, 1)
+
+	result := protoparser.ParseFileDescSets([]*descriptorpb.FileDescriptorSet{newUnannotatedFileDescSet()}, opts)
+	require.True(t, result.Ok())
+	require.Len(t, result.Routes, 2)
+	require.Equal(t, "/v1/test/{name}", result.Routes[0].Path())
+	require.Equal(t, "/test.v1.TestService/List", result.Routes[1].Path())
+
+	opts.Rules[0].Selector = "test.v1.TestService.Missing"
+	result = protoparser.ParseFileDescSets([]*descriptorpb.FileDescriptorSet{newUnannotatedFileDescSet()}, opts)
+	require.True(t, result.Ok(), "unmatched selector is not an error")
+	require.Len(t, result.Warnings, 1)
+}
+
+func TestServiceConfigWildcardRules(t *testing.T) {
+	rules := []*annotations.HttpRule{
+		{Selector: "test.v1.*", Pattern: &annotations.HttpRule_Post{Post: "/v1/any"}, Body: "*"},
+		{Selector: "test.v1.TestService.*", Pattern: &annotations.HttpRule_Post{Post: "/v1/test"}, Body: "*"},
+		{Selector: "test.v1.TestService.Get", Pattern: &annotations.HttpRule_Get{Get: "/v1/test/{name}"}},
+	}
+
+	result := protoparser.ParseFileDescSets([]*descriptorpb.FileDescriptorSet{newUnannotatedFileDescSet()}, &protoparser.Options{
+		Rules: rules,
+	})
+	require.True(t, result.Ok())
+	require.Len(t, result.Routes, 2)
+	require.Equal(t, "/v1/test/{name}", result.Routes[0].Path(), "full name takes precedence over wildcards")
+	require.Equal(t, "/v1/test", result.Routes[1].Path(), "longer wildcard takes precedence")
+	require.Len(t, result.Warnings, 1, "shadowed wildcard does not match any method")
+
+	for _, selector := range []string{"test.*.Get", "test.v1.Test*", ""} {
+		rule := &annotations.HttpRule{Selector: selector, Pattern: &annotations.HttpRule_Get{Get: "/v1/test"}}
+		result = protoparser.ParseFileDescSets(nil, &protoparser.Options{Rules: []*annotations.HttpRule{rule}})
+		require.False(t, result.Ok(), selector)
+	}
+}
+
+func TestServiceConfigPrecedence(t *testing.T) {
+	protoFile, err := os.ReadFile("../../../cmd/examples/grpcserver/gen/user/v1/user.desc")
+	require.NoError(t, err)
+
+	pbSet := new(descriptorpb.FileDescriptorSet)
+	require.NoError(t, proto.Unmarshal(protoFile, pbSet))
+
+	rule := &annotations.HttpRule{
+		Selector: "user.v1.UserService.GetUser",
+		Pattern:  &annotations.HttpRule_Get{Get: "/v2/user/{username}"},
+	}
+
+	tests := []struct {
+		precedence protoparser.Precedence
+		paths      []string
+	}{
+		{precedence: "", paths: []string{"/api/user/{username}"}},
+		{precedence: protoparser.AnnotationsPrecedence, paths: []string{"/api/user/{username}"}},
+		{precedence: protoparser.ServiceConfigPrecedence, paths: []string{"/v2/user/{username}"}},
+		{precedence: protoparser.MergePrecedence, paths: []string{"/api/user/{username}", "/v2/user/{username}"}},
+	}
+
+	for _, tt := range tests {
+		result := protoparser.ParseFileDescSets([]*descriptorpb.FileDescriptorSet{pbSet}, &protoparser.Options{
+			Rules:      []*annotations.HttpRule{rule},
+			Precedence: tt.precedence,
+		})
+		require.True(t, result.Ok())
+
+		var paths []string
+		for _, route := range result.Routes {
+			if route.GrpcSpec().Method == "GetUser" {
+				paths = append(paths, route.Path())
+			}
+		}
+		require.Equal(t, tt.paths, paths, tt.precedence)
+	}
+}
+
+func TestWellKnownDependencies(t *testing.T) {
+	fdSet := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:       proto.String("test/v1/timeout.proto"),
+		Package:    proto.String("test.v1"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/duration.proto", "google/rpc/error_details.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Timeout"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("value"),
+				Number:   proto.Int32(1),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+				TypeName: proto.String(".google.protobuf.Duration"),
+			}},
+		}},
+	}}}
+
+	var names []string
+	for _, fd := range protoparser.SortByDependencies([]*descriptorpb.FileDescriptorSet{fdSet}) {
+		names = append(names, fd.GetName())
+	}
+	require.Equal(t, []string{"test/v1/timeout.proto"}, names, "bundled files are registered before parsing, not sorted")
+
+	result := protoparser.ParseFileDescSets([]*descriptorpb.FileDescriptorSet{fdSet}, nil)
+	require.True(t, result.Ok(), result.ErrorsString())
+
+	for _, name := range []protoreflect.FullName{"google.rpc.BadRequest", "google.rpc.ErrorInfo", "google.protobuf.Struct"} {
+		_, err := result.TypeResolver.FindMessageByName(name)
+		require.NoError(t, err, name)
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/eset/grpc-rest-proxy/pkg/service/router"
 
+	"google.golang.org/genproto/googleapis/api/annotations"
 	"google.golang.org/protobuf/reflect/protoregistry"
 )
 
@@ -15,7 +16,16 @@ type ParseResult struct {
 	FileRegistry *protoregistry.Files
 	TypeResolver *protoregistry.Types
 	Routes       []*router.Route
-	Errors       []error
+	// all methods of parsed services, with or without HTTP annotations, keyed by full gRPC path
+	Methods map[string]*router.GrpcSpec
+	Errors  []error
+	// problems which do not prevent use of the result, e.g. selectors which do not match any method
+	Warnings []error
+
+	options *Options
+	// HTTP rules of service configuration by selector and selectors which matched a method
+	rules      map[string]*annotations.HttpRule
+	boundRules map[string]bool
 }
 
 func (r *ParseResult) Ok() bool {
@@ -26,10 +36,18 @@ func (r *ParseResult) AddError(err error) {
 	r.Errors = append(r.Errors, err)
 }
 
+func (r *ParseResult) AddWarning(err error) {
+	r.Warnings = append(r.Warnings, err)
+}
+
 func (r *ParseResult) AddRoute(route *router.Route) {
 	r.Routes = append(r.Routes, route)
 }
 
+func (r *ParseResult) AddMethod(spec *router.GrpcSpec) {
+	r.Methods[spec.FullPath()] = spec
+}
+
 func (r *ParseResult) ErrorsString() string {
 	var sb strings.Builder
 
@@ -14,6 +14,9 @@ type GrpcSpec struct {
 	ResponseDesc protoreflect.MessageDescriptor
 	Service      string
 	Method       string
+	// streaming kind of the method, REST routes support unary methods only
+	ClientStreaming bool
+	ServerStreaming bool
 }
 
 func (g *GrpcSpec) FullPath() string {
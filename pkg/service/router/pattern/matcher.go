@@ -3,7 +3,14 @@
 
 package pattern
 
-import "github.com/eset/grpc-rest-proxy/pkg/service/transformer"
+import (
+	"net/url"
+	"strings"
+
+	"github.com/eset/grpc-rest-proxy/pkg/service/transformer"
+
+	jErrors "github.com/juju/errors"
+)
 
 type Matcher struct {
 	ops  []Operation
@@ -15,19 +22,39 @@ type MatchResult struct {
 	Vars    []transformer.Variable
 }
 
+// Match matches escaped path of the request, e.g. URL.EscapedPath(). Path is split to segments before
+// percent-decoding, so encoded slash never separates segments. Verb is expected only in the last segment,
+// patterns without verb match colons of the last segment as part of the path.
 func (m *Matcher) Match(path string) MatchResult {
+	return m.match(path, func(a, b string) bool { return a == b })
+}
+
+// MatchFold matches like Match but literal segments and verb are compared regardless of case.
+func (m *Matcher) MatchFold(path string) MatchResult {
+	return m.match(path, strings.EqualFold)
+}
+
+func (m *Matcher) match(path string, equal func(a, b string) bool) MatchResult {
 	res := MatchResult{
 		Matched: false,
 	}
 
-	path, verb := splitByVerb(path)
-	if verb != m.verb {
+	if m.verb != "" {
+		var verb string
+		path, verb = splitByVerb(path)
+		if verb, err := url.PathUnescape(verb); err != nil || !equal(verb, m.verb) {
+			return res
+		}
+	}
+
+	// trailing slash is an empty segment, which is matched only by **
+	if len(path) > 1 && strings.HasSuffix(path, "/") && !m.endsWithAnySegments() {
 		return res
 	}
 
 	segmentItr := newSegmentItr(path)
 
-	matched := match(m.ops, &segmentItr, &res)
+	matched := match(m.ops, &segmentItr, &res, equal)
 	res.Matched = matched
 
 	// check if all segments are matched
@@ -37,7 +64,7 @@ func (m *Matcher) Match(path string) MatchResult {
 	return res
 }
 
-func match(ops []Operation, segmentItr *segmentItr, res *MatchResult) bool {
+func match(ops []Operation, segmentItr *segmentItr, res *MatchResult, equal func(a, b string) bool) bool {
 	for _, op := range ops {
 		switch op.OpCode {
 		case NoneOpCode:
@@ -47,7 +74,8 @@ func match(ops []Operation, segmentItr *segmentItr, res *MatchResult) bool {
 				return false
 			}
 
-			if op.Values[0] != segmentItr.next() {
+			segment, err := url.PathUnescape(segmentItr.next())
+			if err != nil || !equal(op.Values[0], segment) {
 				return false
 			}
 		case AnyOnceCode:
@@ -62,7 +90,10 @@ func match(ops []Operation, segmentItr *segmentItr, res *MatchResult) bool {
 			segmentItr.skipToEnd()
 			continue
 		case EndCaptureCode:
-			variableValue := segmentItr.capture()
+			variableValue, err := unescapeCapture(segmentItr.capture(), op.MultiSegment)
+			if err != nil {
+				return false
+			}
 			res.Vars = append(res.Vars, transformer.Variable{
 				FieldPath: op.Values,
 				Value:     variableValue,
@@ -74,6 +105,29 @@ func match(ops []Operation, segmentItr *segmentItr, res *MatchResult) bool {
 	return true
 }
 
+// unescapeCapture decodes value of single-segment variable completely, values of multi-segment variables
+// keep encoded slashes to distinguish them from segment separators.
+func unescapeCapture(value string, multiSegment bool) (string, error) {
+	if multiSegment {
+		return unescapeMultiSegment(value)
+	}
+	return url.PathUnescape(value)
+}
+
+func (m *Matcher) endsWithAnySegments() bool {
+	for i := len(m.ops) - 1; i >= 0; i-- {
+		if m.ops[i].OpCode != EndCaptureCode {
+			return m.ops[i].OpCode == AnyZeroOrMoreCode
+		}
+	}
+	return false
+}
+
+// HasVerb reports whether the pattern ends with verb, e.g. /v1/{name=things/*}:cancel.
+func (m *Matcher) HasVerb() bool {
+	return m.verb != ""
+}
+
 func (m *Matcher) GetAllVariablePaths() [][]string {
 	var paths [][]string
 	for _, op := range m.ops {
@@ -84,3 +138,20 @@ func (m *Matcher) GetAllVariablePaths() [][]string {
 
 	return paths
 }
+
+// ResolveVariablePaths replaces field paths of all variables by paths returned by resolve, e.g. to translate
+// JSON names of fields to proto names.
+func (m *Matcher) ResolveVariablePaths(resolve func(fieldPath []string) ([]string, error)) error {
+	for idx := range m.ops {
+		if m.ops[idx].OpCode != EndCaptureCode {
+			continue
+		}
+
+		resolved, err := resolve(m.ops[idx].Values)
+		if err != nil {
+			return jErrors.Trace(err)
+		}
+		m.ops[idx].Values = resolved
+	}
+	return nil
+}
@@ -126,7 +126,8 @@ func parseSegmentsItr(pattern string, inVariable bool) ([]Operation, error) {
 			}
 			ops = append(ops, Operation{OpCode: StartCaptureCode})
 			ops = append(ops, varOps...)
-			ops = append(ops, Operation{OpCode: EndCaptureCode, Values: fieldPath})
+			multiSegment := len(varOps) != 1 || varOps[0].OpCode == AnyZeroOrMoreCode
+			ops = append(ops, Operation{OpCode: EndCaptureCode, Values: fieldPath, MultiSegment: multiSegment})
 			continue
 		}
 
@@ -3,7 +3,12 @@
 
 package pattern
 
-import "strings"
+import (
+	"net/url"
+	"strings"
+
+	jErrors "github.com/juju/errors"
+)
 
 type OpType int
 
@@ -19,6 +24,8 @@ const (
 type Operation struct {
 	OpCode OpType
 	Values []string
+	// EndCaptureCode of variable spanning multiple segments, e.g. {name=**}, whose value keeps encoded slashes
+	MultiSegment bool
 }
 
 type CaptureVariable struct {
@@ -26,11 +33,43 @@ type CaptureVariable struct {
 	Ops       []Operation
 }
 
+// splitByVerb splits verb following the last colon of the last segment, colons of other segments and
+// of variable patterns are part of the path.
 func splitByVerb(path string) (pattern string, verb string) {
-	verbIdx := strings.IndexRune(path, ':')
+	lastSegmentIdx := max(strings.LastIndexByte(path, '/'), strings.LastIndexByte(path, '}'))
+	verbIdx := strings.LastIndexByte(path[lastSegmentIdx+1:], ':')
 	if verbIdx == -1 {
 		return path, ""
 	}
 
+	verbIdx += lastSegmentIdx + 1
 	return path[:verbIdx], path[verbIdx+1:]
 }
+
+// unescapeMultiSegment decodes value of multi-segment variable except encoded slashes, which are left unchanged
+// as google.api.HttpRule requires.
+func unescapeMultiSegment(value string) (string, error) {
+	var sb strings.Builder
+	start := 0
+	for i := 0; i+2 < len(value); i++ {
+		if value[i] != '%' || value[i+1] != '2' || (value[i+2] != 'F' && value[i+2] != 'f') {
+			continue
+		}
+
+		part, err := url.PathUnescape(value[start:i])
+		if err != nil {
+			return "", jErrors.Trace(err)
+		}
+		sb.WriteString(part)
+		sb.WriteString(value[i : i+3])
+		start = i + 3
+		i += 2
+	}
+
+	part, err := url.PathUnescape(value[start:])
+	if err != nil {
+		return "", jErrors.Trace(err)
+	}
+	sb.WriteString(part)
+	return sb.String(), nil
+}
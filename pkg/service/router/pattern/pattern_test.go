@@ -59,9 +59,55 @@ func TestPatternsMatching(t *testing.T) {
 			tests: []patternTest{
 				{path: "/api/v1/users", matched: true},
 				{path: "/api/v1/users:foo", matched: false},
+				{path: "/api/v1/users/", matched: false},
 				{path: "/api/v2/users", matched: false},
 			},
 		},
+		{
+			pattern: "/v1/files/{id}/{path=**}",
+			valid:   true,
+			tests: []patternTest{
+				{
+					path:    "/v1/files/a%2Fb%20c/dir/x%2Fy%2fz%3A",
+					matched: true,
+					matchedParams: []transformer.Variable{
+						{FieldPath: []string{"id"}, Value: "a/b c"},
+						{FieldPath: []string{"path"}, Value: "dir/x%2Fy%2fz:"},
+					},
+				},
+				{path: "/v1/fil%65s/1/dir", matched: true},
+				{path: "/v1/files/a%2", matched: false},
+			},
+		},
+		{
+			pattern: "/v1/{name=things/*}:cancel",
+			valid:   true,
+			tests: []patternTest{
+				{
+					path:    "/v1/things/a:b:cancel",
+					matched: true,
+					matchedParams: []transformer.Variable{
+						{FieldPath: []string{"name"}, Value: "things/a:b"},
+					},
+				},
+				{path: "/v1/things/a%3Acancel", matched: false},
+				{path: "/v1/things/a", matched: false},
+			},
+		},
+		{
+			pattern: "/v1/{name=things/*}",
+			valid:   true,
+			tests: []patternTest{
+				{
+					path:    "/v1/things/a:b",
+					matched: true,
+					matchedParams: []transformer.Variable{
+						{FieldPath: []string{"name"}, Value: "things/a:b"},
+					},
+				},
+				{path: "/v1/things:b/a", matched: false},
+			},
+		},
 		{pattern: "/",
 			valid: true,
 			tests: []patternTest{
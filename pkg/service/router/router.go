@@ -18,7 +18,8 @@ type Match struct {
 }
 
 type Router struct {
-	routesByMethod map[MethodType][]routeMatcher
+	routesByMethod  map[MethodType][]routeMatcher
+	caseInsensitive bool
 }
 
 func NewRouter() *Router {
@@ -27,6 +28,13 @@ func NewRouter() *Router {
 	}
 }
 
+// NewCaseInsensitiveRouter creates router matching literal segments and verbs of patterns regardless of case.
+func NewCaseInsensitiveRouter() *Router {
+	r := NewRouter()
+	r.caseInsensitive = true
+	return r
+}
+
 func NewRouterWithRoutes(route []*Route) (*Router, error) {
 	r := NewRouter()
 	for _, rt := range route {
@@ -45,20 +53,33 @@ type routeMatcher struct {
 	bodyRule transformer.HTTPBodyRule
 }
 
+// Find returns the first route matching escaped path of the request, e.g. URL.EscapedPath().
 func (r *Router) Find(method MethodType, path string) (result *Match) {
 	routes, ok := r.routesByMethod[method]
 	if !ok {
 		return nil
 	}
 
-	for _, route := range routes {
-		matchRes := route.matcher.Match(path)
-		if matchRes.Matched {
-			return &Match{
-				GrpcSpec: route.grpcSpec,
-				Pattern:  route.pattern,
-				BodyRule: route.bodyRule,
-				Params:   matchRes.Vars,
+	// routes with verb take precedence, so the verb is not captured by variable of route without verb
+	for _, withVerb := range []bool{true, false} {
+		for _, route := range routes {
+			if route.matcher.HasVerb() != withVerb {
+				continue
+			}
+
+			var matchRes routePattern.MatchResult
+			if r.caseInsensitive {
+				matchRes = route.matcher.MatchFold(path)
+			} else {
+				matchRes = route.matcher.Match(path)
+			}
+			if matchRes.Matched {
+				return &Match{
+					GrpcSpec: route.grpcSpec,
+					Pattern:  route.pattern,
+					BodyRule: route.bodyRule,
+					Params:   matchRes.Vars,
+				}
 			}
 		}
 	}
@@ -76,12 +97,16 @@ func (r *Router) Push(route *Route) error {
 		return jErrors.Errorf("request descriptor is required")
 	}
 
-	variablePaths := matcher.GetAllVariablePaths()
-	for _, variablePath := range variablePaths {
-		err = transformer.ValidateFieldPath(route.grpcSpec.RequestDesc, variablePath)
-		if err != nil {
-			return jErrors.Trace(err)
+	// variables may use JSON names of fields, captured values are bound by proto names
+	err = matcher.ResolveVariablePaths(func(variablePath []string) ([]string, error) {
+		resolved, ok := transformer.ResolveFieldPath(route.grpcSpec.RequestDesc, variablePath, transformer.FieldNamingBoth)
+		if !ok {
+			resolved = variablePath
 		}
+		return resolved, jErrors.Trace(transformer.ValidateFieldPath(route.grpcSpec.RequestDesc, resolved))
+	})
+	if err != nil {
+		return jErrors.Trace(err)
 	}
 
 	routes := r.routesByMethod[route.method]
@@ -32,6 +32,18 @@ var routeTests = []routeTest{
 		found:   true,
 		resPath: "t3",
 	},
+	{
+		method:  router.GET,
+		path:    "/api/v3/things/a:b",
+		found:   true,
+		resPath: "t4",
+	},
+	{
+		method:  router.GET,
+		path:    "/api/v3/things/a:b:cancel",
+		found:   true,
+		resPath: "t5",
+	},
 }
 
 func TestRouter(t *testing.T) {
@@ -46,6 +58,8 @@ func TestRouter(t *testing.T) {
 		router.NewRoute("/api/v2/rules/body/test1", "", router.GET, &router.GrpcSpec{Service: "t3", Method: "m3", RequestDesc: msgDesc}),
 		router.NewRoute("/api/v2/rules/body/test2", "*", router.GET, &router.GrpcSpec{Service: "t3", Method: "m3", RequestDesc: msgDesc}),
 		router.NewRoute("/api/v2/rules/body/test3", "custom.path", router.GET, &router.GrpcSpec{Service: "t3", Method: "m3", RequestDesc: msgDesc}),
+		router.NewRoute("/api/v3/{selector=things/*}", "", router.GET, &router.GrpcSpec{Service: "t4", Method: "m4", RequestDesc: msgDesc}),
+		router.NewRoute("/api/v3/{selector=things/*}:cancel", "", router.GET, &router.GrpcSpec{Service: "t5", Method: "m5", RequestDesc: msgDesc}),
 	}
 
 	for _, route := range routes {
@@ -76,3 +90,38 @@ func TestRouter(t *testing.T) {
 		require.Equal(t, routeTest.resPath, res.GrpcSpec.Service)
 	}
 }
+
+func TestCaseInsensitiveRouter(t *testing.T) {
+	msgDesc := (&annotations.HttpRule{}).ProtoReflect().Descriptor()
+	route := router.NewRoute("/api/v1/rules/{selector}:cancel", "", router.GET, &router.GrpcSpec{Service: "t1", Method: "m1", RequestDesc: msgDesc})
+
+	tree := router.NewRouter()
+	require.NoError(t, tree.Push(route))
+	require.Nil(t, tree.Find(router.GET, "/API/v1/Rules/ABC:Cancel"))
+
+	tree = router.NewCaseInsensitiveRouter()
+	require.NoError(t, tree.Push(route))
+	res := tree.Find(router.GET, "/API/v1/Rules/ABC:Cancel")
+	require.NotNil(t, res)
+	require.Equal(t, "ABC", res.Params[0].Value)
+}
+
+func TestRouterJSONNameVariables(t *testing.T) {
+	tree := router.NewRouter()
+	msgDesc := (&annotations.HttpRule{}).ProtoReflect().Descriptor()
+	spec := &router.GrpcSpec{Service: "t1", Method: "m1", RequestDesc: msgDesc}
+
+	require.NoError(t, tree.Push(router.NewRoute("/api/v1/rules/{responseBody}", "", router.GET, spec)))
+	require.NoError(t, tree.Push(router.NewRoute("/api/v1/rules/{selector}/{response_body}", "", router.GET, spec)))
+	require.Error(t, tree.Push(router.NewRoute("/api/v1/{unknownField}", "", router.GET, spec)))
+
+	match := tree.Find(router.GET, "/api/v1/rules/json")
+	require.NotNil(t, match)
+	require.Len(t, match.Params, 1)
+	require.Equal(t, []string{"response_body"}, match.Params[0].FieldPath, "JSON name is resolved to proto name")
+
+	match = tree.Find(router.GET, "/api/v1/rules/a/b")
+	require.NotNil(t, match)
+	require.Len(t, match.Params, 2)
+	require.Equal(t, []string{"response_body"}, match.Params[1].FieldPath)
+}
@@ -3,7 +3,14 @@
 
 package transformer
 
-import "strings"
+import (
+	"mime"
+	"strings"
+
+	jErrors "github.com/juju/errors"
+)
+
+const UnsupportedContentType = jErrors.ConstError("unsupported content type")
 
 type BodyRuleType int
 
@@ -13,6 +20,15 @@ const (
 	FieldPathRule
 )
 
+type BodyFormat int
+
+const (
+	JSONBodyFormat BodyFormat = iota
+	ProtobufBodyFormat
+	FormBodyFormat
+	MultipartBodyFormat
+)
+
 type HTTPBodyRule struct {
 	RuleType  BodyRuleType
 	FieldPath []string
@@ -29,3 +45,29 @@ func GetHTTPBodyRule(rule string) HTTPBodyRule {
 		return HTTPBodyRule{RuleType: FieldPathRule, FieldPath: fieldPath}
 	}
 }
+
+// GetBodyFormat returns format of request body according to its Content-Type. Missing content type and
+// text/plain mean JSON, so clients which do not label JSON bodies keep working. Other types are unsupported.
+func GetBodyFormat(contentType string) (BodyFormat, error) {
+	if contentType == "" {
+		return JSONBodyFormat, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return JSONBodyFormat, jErrors.Annotate(UnsupportedContentType, err.Error())
+	}
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") || mediaType == "text/plain":
+		return JSONBodyFormat, nil
+	case mediaType == "application/x-protobuf" || mediaType == "application/protobuf":
+		return ProtobufBodyFormat, nil
+	case mediaType == "application/x-www-form-urlencoded":
+		return FormBodyFormat, nil
+	case mediaType == "multipart/form-data":
+		return MultipartBodyFormat, nil
+	default:
+		return JSONBodyFormat, jErrors.Annotatef(UnsupportedContentType, "%s", mediaType)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package transformer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	jErrors "github.com/juju/errors"
+)
+
+const (
+	UnknownField     = jErrors.ConstError("unknown field")
+	InvalidFieldPath = jErrors.ConstError("invalid field path")
+	InvalidValue     = jErrors.ConstError("invalid value")
+)
+
+// FieldError is failure of binding path or query parameter to the field of the request message.
+type FieldError struct {
+	// path of the field as it was requested, segments are joined by dots
+	Field string
+	// one of UnknownField, InvalidFieldPath and InvalidValue
+	Kind jErrors.ConstError
+	// underlying error which may describe internals of the service
+	Err error
+}
+
+func newFieldError(fieldPath []string, err error) *FieldError {
+	kind := InvalidValue
+	switch {
+	case errors.Is(err, UnknownField):
+		kind = UnknownField
+	case errors.Is(err, InvalidFieldPath):
+		kind = InvalidFieldPath
+	}
+	return &FieldError{Field: strings.Join(fieldPath, "."), Kind: kind, Err: err}
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Kind, e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// BodyError is failure of decoding request body.
+type BodyError struct {
+	// path of the field the body is bound to, empty when whole request message is bound to the body
+	Field string
+	// offset of JSON syntax error in the body or -1 when the body is syntactically valid
+	Offset int64
+	// underlying error which may describe internals of the service
+	Err error
+}
+
+func newBodyError(fieldPath []string, err error) *BodyError {
+	bodyErr := &BodyError{Field: strings.Join(fieldPath, "."), Offset: -1, Err: err}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		bodyErr.Offset = syntaxErr.Offset
+	}
+	return bodyErr
+}
+
+// Reason describes the failure without details of the underlying error.
+func (e *BodyError) Reason() string {
+	if e.Offset >= 0 {
+		return fmt.Sprintf("invalid JSON at offset %d", e.Offset)
+	}
+	return "invalid request body"
+}
+
+func (e *BodyError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Reason(), e.Err)
+}
+
+func (e *BodyError) Unwrap() error {
+	return e.Err
+}
+
+// validateJSON reports syntax errors of the body including their offset, protojson does not expose them.
+func validateJSON(body []byte) error {
+	if json.Valid(body) {
+		return nil
+	}
+
+	var value any
+	err := json.Unmarshal(body, &value)
+	if err == nil {
+		return jErrors.New("invalid JSON")
+	}
+	return jErrors.Trace(err)
+}
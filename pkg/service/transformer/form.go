@@ -0,0 +1,177 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package transformer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"slices"
+
+	jErrors "github.com/juju/errors"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const PartTooLarge = jErrors.ConstError("part of multipart body is too large")
+
+// processFormBody maps fields of URL-encoded form onto the request message the same way as query parameters.
+// Fields are relative to the field the body is bound to.
+func processFormBody(bodyRule HTTPBodyRule, body []byte, protoRequest *dynamicpb.Message, opts *RequestOptions) error {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return newBodyError(bodyRule.FieldPath, err)
+	}
+
+	// elements of repeated fields are appended in order of their indexes
+	names := slices.Collect(maps.Keys(values))
+	slices.SortFunc(names, func(a, b string) int { return compareFieldPaths(ParseFieldPath(a), ParseFieldPath(b)) })
+
+	for _, name := range names {
+		fieldPath, ok, err := resolveFormField(protoRequest.Descriptor(), bodyRule, name, opts)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// ignored unknown field
+			continue
+		}
+
+		for _, value := range values[name] {
+			if err = insertValueByPath(protoRequest, fieldPath, value, valueOptions{rawBytes: opts.rawBytes()}); err != nil {
+				return newFieldError(ParseFieldPath(name), err)
+			}
+		}
+	}
+	return nil
+}
+
+// processMultipartBody maps text parts onto fields of the request message like URL-encoded form fields.
+// File parts are stored to bytes or google.api.HttpBody fields.
+func processMultipartBody(
+	bodyRule HTTPBodyRule,
+	body []byte,
+	contentType string,
+	protoRequest *dynamicpb.Message,
+	opts *RequestOptions,
+) error {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil || params["boundary"] == "" {
+		return jErrors.Annotate(UnsupportedContentType, "multipart boundary is missing")
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return newBodyError(bodyRule.FieldPath, err)
+		}
+
+		if err = processPart(bodyRule, part, protoRequest, opts); err != nil {
+			return err
+		}
+	}
+}
+
+func processPart(bodyRule HTTPBodyRule, part *multipart.Part, protoRequest *dynamicpb.Message, opts *RequestOptions) error {
+	defer part.Close()
+
+	name := part.FormName()
+	if name == "" {
+		return nil
+	}
+
+	fieldPath, ok, err := resolveFormField(protoRequest.Descriptor(), bodyRule, name, opts)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// ignored unknown part, following parts are still processed
+		return nil
+	}
+
+	data, err := readPart(part, opts)
+	if err != nil {
+		return newFieldError(ParseFieldPath(name), err)
+	}
+
+	if part.FileName() == "" {
+		err = insertValueByPath(protoRequest, fieldPath, string(data), valueOptions{rawBytes: opts.rawBytes()})
+	} else {
+		err = setFileValue(protoRequest, fieldPath, part.Header.Get("Content-Type"), data)
+	}
+	if err != nil {
+		return newFieldError(ParseFieldPath(name), err)
+	}
+	return nil
+}
+
+func readPart(part *multipart.Part, opts *RequestOptions) ([]byte, error) {
+	if opts == nil || opts.MaxPartSize <= 0 {
+		data, err := io.ReadAll(part)
+		return data, jErrors.Trace(err)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(part, opts.MaxPartSize+1))
+	if err != nil {
+		return nil, jErrors.Trace(err)
+	}
+	if int64(len(data)) > opts.MaxPartSize {
+		return nil, jErrors.Trace(PartTooLarge)
+	}
+	return data, nil
+}
+
+// resolveFormField returns field path of the form field in proto names. It returns false for unknown
+// fields which are ignored.
+func resolveFormField(
+	desc protoreflect.MessageDescriptor,
+	bodyRule HTTPBodyRule,
+	name string,
+	opts *RequestOptions,
+) ([]string, bool, error) {
+	var naming FieldNaming
+	if opts != nil {
+		naming = opts.FieldNaming
+	}
+
+	fieldPath := ParseFieldPath(name)
+	resolved, ok := ResolveFieldPath(desc, append(slices.Clone(bodyRule.FieldPath), fieldPath...), naming)
+	switch {
+	case ok:
+		return resolved, true, nil
+	case opts != nil && opts.IgnoreUnknownFields:
+		return nil, false, nil
+	default:
+		return nil, false, newFieldError(fieldPath, jErrors.Trace(UnknownField))
+	}
+}
+
+// setFileValue stores content of uploaded file to bytes field or to google.api.HttpBody field together
+// with its content type.
+func setFileValue(msg protoreflect.Message, fieldPath []string, contentType string, data []byte) error {
+	parent, field, err := findInnerField(msg, fieldPath)
+	if err != nil {
+		return jErrors.Trace(err)
+	}
+
+	switch {
+	case field.Kind() == protoreflect.BytesKind && field.IsList():
+		parent.Mutable(field).List().Append(protoreflect.ValueOfBytes(data))
+	case field.Kind() == protoreflect.BytesKind && !field.IsMap():
+		parent.Set(field, protoreflect.ValueOfBytes(data))
+	case field.Kind() == protoreflect.MessageKind && !field.IsList() && IsHTTPBody(field.Message()):
+		setHTTPBody(parent.Mutable(field).Message(), contentType, data)
+	default:
+		return jErrors.Errorf("file cannot be stored to field %s", field.Name())
+	}
+	return nil
+}
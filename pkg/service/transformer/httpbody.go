@@ -0,0 +1,57 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package transformer
+
+import (
+	jErrors "github.com/juju/errors"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	httpBodyName = "google.api.HttpBody"
+
+	defaultHTTPBodyContentType = "application/octet-stream"
+)
+
+// IsHTTPBody reports whether message is google.api.HttpBody, which carries raw HTTP body and its content type.
+func IsHTTPBody(desc protoreflect.MessageDescriptor) bool {
+	return desc.FullName() == httpBodyName
+}
+
+// GetHTTPBody returns content type and data of google.api.HttpBody message. Missing content type
+// is reported as application/octet-stream.
+func GetHTTPBody(msg protoreflect.Message) (string, []byte) {
+	fields := msg.Descriptor().Fields()
+	contentType := msg.Get(fields.ByName("content_type")).String()
+	if contentType == "" {
+		contentType = defaultHTTPBodyContentType
+	}
+	return contentType, msg.Get(fields.ByName("data")).Bytes()
+}
+
+// findHTTPBody returns google.api.HttpBody message the request body is bound to.
+func findHTTPBody(protoRequest protoreflect.Message, bodyRule HTTPBodyRule) (protoreflect.Message, bool, error) {
+	switch bodyRule.RuleType {
+	case MapRootRule:
+		return protoRequest, IsHTTPBody(protoRequest.Descriptor()), nil
+	case FieldPathRule:
+		msg, fieldDesc, err := findInnerField(protoRequest, bodyRule.FieldPath)
+		if err != nil {
+			return nil, false, jErrors.Trace(err)
+		}
+		if fieldDesc.Kind() != protoreflect.MessageKind || fieldDesc.IsList() || !IsHTTPBody(fieldDesc.Message()) {
+			return nil, false, nil
+		}
+		return msg.Mutable(fieldDesc).Message(), true, nil
+	default:
+		return nil, false, nil
+	}
+}
+
+// setHTTPBody stores raw body and its content type to google.api.HttpBody message.
+func setHTTPBody(msg protoreflect.Message, contentType string, body []byte) {
+	fields := msg.Descriptor().Fields()
+	msg.Set(fields.ByName("content_type"), protoreflect.ValueOfString(contentType))
+	msg.Set(fields.ByName("data"), protoreflect.ValueOfBytes(body))
+}
@@ -4,6 +4,10 @@
 package transformer
 
 import (
+	"net/http"
+	"slices"
+	"strings"
+
 	jErrors "github.com/juju/errors"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
@@ -11,44 +15,185 @@ import (
 	"google.golang.org/protobuf/types/dynamicpb"
 )
 
+const requestKeySeparator = "\x00"
+
+// RequestOptions control decoding of the request body and parameters.
+type RequestOptions struct {
+	// Content-Type of the body, missing content type means JSON
+	ContentType string
+	// names of form fields, both proto and JSON names are accepted when empty
+	FieldNaming FieldNaming
+	// form fields which do not address any field of the request message are ignored instead of rejected
+	IgnoreUnknownFields bool
+	// maximum size of a single part of multipart body in bytes, unlimited when zero
+	MaxPartSize int64
+	// bytes fields of parameters and form fields take values as they are instead of decoding base64
+	RawBytes bool
+}
+
+func (o *RequestOptions) contentType() string {
+	if o == nil {
+		return ""
+	}
+	return o.ContentType
+}
+
+func (o *RequestOptions) rawBytes() bool {
+	return o != nil && o.RawBytes
+}
+
 func GetRPCRequest(
 	body []byte,
 	requestDesc protoreflect.MessageDescriptor,
 	params []Variable,
 	httpBodyRule HTTPBodyRule,
 ) (*dynamicpb.Message, error) {
+	return GetRPCRequestWithOptions(body, requestDesc, params, httpBodyRule, nil)
+}
+
+// GetRPCRequestWithOptions builds request message like GetRPCRequest, the body is decoded according to
+// content type given by options. Nil options decode the body as JSON.
+func GetRPCRequestWithOptions(
+	body []byte,
+	requestDesc protoreflect.MessageDescriptor,
+	params []Variable,
+	httpBodyRule HTTPBodyRule,
+	opts *RequestOptions,
+) (*dynamicpb.Message, error) {
+	contentType := opts.contentType()
 	protoRequest := dynamicpb.NewMessage(requestDesc)
 
 	var err error
-	if len(body) > 0 {
-		params, err = processRequestBody(httpBodyRule, body, protoRequest, params)
+	var bodyParam *Variable
+	if len(body) > 0 && httpBodyRule.RuleType != NoBodyRule {
+		httpBody, ok, err := findHTTPBody(protoRequest, httpBodyRule)
+		if err != nil {
+			return nil, jErrors.Trace(err)
+		}
+		if ok {
+			// google.api.HttpBody takes the body as it is regardless of its content type
+			setHTTPBody(httpBody, contentType, body)
+			httpBodyRule = HTTPBodyRule{RuleType: NoBodyRule}
+		}
+	}
+
+	if len(body) > 0 && httpBodyRule.RuleType != NoBodyRule {
+		var format BodyFormat
+		format, err = GetBodyFormat(contentType)
+		if err != nil {
+			return nil, jErrors.Trace(err)
+		}
+
+		switch format {
+		case ProtobufBodyFormat:
+			err = processProtobufBody(httpBodyRule, body, protoRequest)
+		case JSONBodyFormat:
+			bodyParam, err = processRequestBody(httpBodyRule, body, protoRequest)
+		case FormBodyFormat:
+			err = processFormBody(httpBodyRule, body, protoRequest, opts)
+		case MultipartBodyFormat:
+			err = processMultipartBody(httpBodyRule, body, contentType, protoRequest, opts)
+		}
 		if err != nil {
 			return nil, jErrors.Trace(err)
 		}
 	}
 
-	err = setVariables(protoRequest, params)
+	err = setVariables(protoRequest, params, valueOptions{rawBytes: opts.rawBytes()})
 	if err != nil {
 		return nil, jErrors.Trace(err)
 	}
 
+	// body bound to the field is set the last, so it overrides parameters of the same field
+	if bodyParam != nil {
+		// raw body bound to bytes field is taken as it is, body bound to message field is always JSON
+		err = insertValueByPath(protoRequest, bodyParam.FieldPath, bodyParam.Value, valueOptions{rawBytes: true, json: true})
+		if err != nil {
+			return nil, newBodyError(bodyParam.FieldPath, err)
+		}
+	}
+
 	return protoRequest, nil
 }
 
-func processRequestBody(bodyRule HTTPBodyRule, body []byte, protoRequest proto.Message, params []Variable) ([]Variable, error) {
+func processProtobufBody(bodyRule HTTPBodyRule, body []byte, protoRequest *dynamicpb.Message) error {
 	switch bodyRule.RuleType {
 	case NoBodyRule:
-		return params, nil
+		return nil
 	case MapRootRule:
-		err := protojson.Unmarshal(body, protoRequest)
+		if err := proto.Unmarshal(body, protoRequest); err != nil {
+			return newBodyError(nil, err)
+		}
+		return nil
+	case FieldPathRule:
+		msg, fieldDesc, err := findInnerField(protoRequest, bodyRule.FieldPath)
 		if err != nil {
-			return nil, jErrors.Trace(err)
+			return jErrors.Trace(err)
+		}
+
+		if fieldDesc.Kind() != protoreflect.MessageKind || fieldDesc.Cardinality() == protoreflect.Repeated {
+			return jErrors.Errorf("protobuf body cannot be bound to field %s", fieldDesc.Name())
+		}
+		if err = proto.Unmarshal(body, msg.Mutable(fieldDesc).Message().Interface()); err != nil {
+			return newBodyError(bodyRule.FieldPath, err)
+		}
+		return nil
+	default:
+		return jErrors.New("unsupported body rules type")
+	}
+}
+
+// processRequestBody decodes JSON body bound to the whole request message. Body bound to the field is returned
+// as variable, which is set after path and query parameters.
+func processRequestBody(bodyRule HTTPBodyRule, body []byte, protoRequest proto.Message) (*Variable, error) {
+	switch bodyRule.RuleType {
+	case NoBodyRule:
+		return nil, nil
+	case MapRootRule:
+		if err := validateJSON(body); err != nil {
+			return nil, newBodyError(nil, err)
 		}
-		return params, nil
+		if err := protojson.Unmarshal(body, protoRequest); err != nil {
+			return nil, newBodyError(nil, err)
+		}
+		return nil, nil
 	case FieldPathRule:
-		params = append(params, Variable{FieldPath: bodyRule.FieldPath, Value: string(body)})
-		return params, nil
+		return &Variable{FieldPath: bodyRule.FieldPath, Value: string(body)}, nil
 	default:
 		return nil, jErrors.New("unsupported body rules type")
 	}
 }
+
+// credentialHeaders are always part of request keys, so responses are never shared among clients with different credentials.
+var credentialHeaders = []string{"Authorization", "Cookie"}
+
+// GetRequestKeyHeaders returns names of request headers identifying the request, credential headers followed
+// by configured headers.
+func GetRequestKeyHeaders(headerNames []string) []string {
+	keyHeaders := slices.Clone(credentialHeaders)
+	for _, name := range headerNames {
+		if !slices.ContainsFunc(keyHeaders, func(keyHeader string) bool { return strings.EqualFold(keyHeader, name) }) {
+			keyHeaders = append(keyHeaders, name)
+		}
+	}
+	return keyHeaders
+}
+
+// GetRequestKey builds key identifying the request by gRPC method, canonical bytes of the request message
+// and values of given request headers.
+func GetRequestKey(grpcMethod string, request proto.Message, header http.Header, headerNames []string) (string, error) {
+	requestBytes, err := proto.MarshalOptions{Deterministic: true}.Marshal(request)
+	if err != nil {
+		return "", jErrors.Trace(err)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(grpcMethod)
+	sb.WriteString(requestKeySeparator)
+	sb.Write(requestBytes)
+	for _, name := range headerNames {
+		sb.WriteString(requestKeySeparator)
+		sb.WriteString(strings.Join(header.Values(name), ","))
+	}
+	return sb.String(), nil
+}
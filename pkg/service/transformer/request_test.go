@@ -4,14 +4,25 @@
 package transformer_test
 
 import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
 	"testing"
+	"time"
 
 	userpb "github.com/eset/grpc-rest-proxy/cmd/examples/grpcserver/gen/user/v1"
 	"github.com/eset/grpc-rest-proxy/pkg/service/transformer"
 
 	"github.com/stretchr/testify/require"
 
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 func TestBasicRequestTransform(t *testing.T) {
@@ -62,6 +73,166 @@ func TestBasicRequestTransform(t *testing.T) {
 	require.Error(t, err, "field test not exist")
 }
 
+func TestRequestBindingErrors(t *testing.T) {
+	msgDesc := (&userpb.CreateUserRequest{}).ProtoReflect().Descriptor()
+	noBody := transformer.HTTPBodyRule{RuleType: transformer.NoBodyRule}
+	userBody := transformer.HTTPBodyRule{RuleType: transformer.FieldPathRule, FieldPath: []string{"user"}}
+
+	var fieldErr *transformer.FieldError
+	_, err := transformer.GetRPCRequest(nil, msgDesc, []transformer.Variable{
+		{FieldPath: []string{"user", "unknown"}, Value: "1"},
+	}, noBody)
+	require.ErrorAs(t, err, &fieldErr)
+	require.Equal(t, "user.unknown", fieldErr.Field)
+	require.ErrorIs(t, err, transformer.UnknownField)
+
+	_, err = transformer.GetRPCRequest(nil, msgDesc, []transformer.Variable{
+		{FieldPath: []string{"user", "id"}, Value: "abc"},
+	}, noBody)
+	require.ErrorAs(t, err, &fieldErr)
+	require.Equal(t, "user.id", fieldErr.Field)
+	require.ErrorIs(t, err, transformer.InvalidValue)
+
+	var bodyErr *transformer.BodyError
+	_, err = transformer.GetRPCRequest([]byte(`{"id": }`), msgDesc, nil, userBody)
+	require.ErrorAs(t, err, &bodyErr)
+	require.Equal(t, "user", bodyErr.Field)
+	require.Equal(t, int64(8), bodyErr.Offset)
+
+	_, err = transformer.GetRPCRequest([]byte(`{"unknown": 1}`), msgDesc, nil,
+		transformer.HTTPBodyRule{RuleType: transformer.MapRootRule})
+	require.ErrorAs(t, err, &bodyErr)
+	require.Empty(t, bodyErr.Field)
+	require.Equal(t, int64(-1), bodyErr.Offset)
+}
+
+func TestWellKnownBodyTransform(t *testing.T) {
+	msgDesc := (&errdetails.RetryInfo{}).ProtoReflect().Descriptor()
+	delayBody := transformer.HTTPBodyRule{RuleType: transformer.FieldPathRule, FieldPath: []string{"retry_delay"}}
+
+	request, err := transformer.GetRPCRequest([]byte(`"1.5s"`), msgDesc, nil, delayBody)
+	require.NoError(t, err)
+	require.True(t, proto.Equal(&errdetails.RetryInfo{RetryDelay: durationpb.New(1500 * time.Millisecond)}, request))
+
+	_, err = transformer.GetRPCRequest([]byte(`1.5s`), msgDesc, nil, delayBody)
+	var bodyErr *transformer.BodyError
+	require.ErrorAs(t, err, &bodyErr, "body bound to well-known type is JSON")
+
+	request, err = transformer.GetRPCRequest(nil, msgDesc, []transformer.Variable{
+		{FieldPath: []string{"retry_delay"}, Value: "2s"},
+	}, transformer.HTTPBodyRule{RuleType: transformer.NoBodyRule})
+	require.NoError(t, err)
+	require.True(t, proto.Equal(&errdetails.RetryInfo{RetryDelay: durationpb.New(2 * time.Second)}, request),
+		"parameters keep plain text format")
+}
+
+func TestHTTPBodyTransform(t *testing.T) {
+	msgDesc := (&httpbody.HttpBody{}).ProtoReflect().Descriptor()
+	require.True(t, transformer.IsHTTPBody(msgDesc))
+
+	request, err := transformer.GetRPCRequestWithOptions([]byte("id,name\n1,John\n"), msgDesc, nil,
+		transformer.HTTPBodyRule{RuleType: transformer.MapRootRule}, &transformer.RequestOptions{ContentType: "text/csv"})
+	require.NoError(t, err)
+
+	contentType, data := transformer.GetHTTPBody(request)
+	require.Equal(t, "text/csv", contentType)
+	require.Equal(t, []byte("id,name\n1,John\n"), data)
+
+	contentType, data = transformer.GetHTTPBody((&httpbody.HttpBody{Data: []byte{1, 2}}).ProtoReflect())
+	require.Equal(t, "application/octet-stream", contentType)
+	require.Equal(t, []byte{1, 2}, data)
+}
+
+func TestFormBodyTransform(t *testing.T) {
+	msgDesc := (&userpb.CreateUserRequest{}).ProtoReflect().Descriptor()
+	userBody := transformer.HTTPBodyRule{RuleType: transformer.FieldPathRule, FieldPath: []string{"user"}}
+	contentType := "application/x-www-form-urlencoded"
+
+	request, err := transformer.GetRPCRequestWithOptions([]byte("username=John&address.countryCode=SK"),
+		msgDesc, nil, userBody, &transformer.RequestOptions{ContentType: contentType})
+	require.NoError(t, err)
+	expected := &userpb.CreateUserRequest{User: &userpb.User{Username: "John", Address: &userpb.Address{CountryCode: "SK"}}}
+	require.True(t, proto.Equal(expected, request))
+
+	var fieldErr *transformer.FieldError
+	_, err = transformer.GetRPCRequestWithOptions([]byte("unknown=1"), msgDesc, nil, userBody, &transformer.RequestOptions{ContentType: contentType})
+	require.ErrorAs(t, err, &fieldErr)
+	require.ErrorIs(t, err, transformer.UnknownField)
+
+	_, err = transformer.GetRPCRequestWithOptions([]byte("unknown=1"), msgDesc, nil, userBody,
+		&transformer.RequestOptions{ContentType: contentType, IgnoreUnknownFields: true})
+	require.NoError(t, err)
+
+	// fields are sorted by name, so the unknown field precedes the known one
+	request, err = transformer.GetRPCRequestWithOptions([]byte("aaa_unknown=1&username=John"), msgDesc, nil, userBody,
+		&transformer.RequestOptions{ContentType: contentType, IgnoreUnknownFields: true})
+	require.NoError(t, err)
+	require.True(t, proto.Equal(&userpb.CreateUserRequest{User: &userpb.User{Username: "John"}}, request),
+		"fields following ignored unknown field are kept")
+}
+
+func TestMultipartBodyTransform(t *testing.T) {
+	msgDesc := (&wrapperspb.BytesValue{}).ProtoReflect().Descriptor()
+	rootBody := transformer.HTTPBodyRule{RuleType: transformer.MapRootRule}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("value", "avatar.png")
+	require.NoError(t, err)
+	_, err = part.Write([]byte{0x89, 'P', 'N', 'G'})
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	request, err := transformer.GetRPCRequestWithOptions(body.Bytes(), msgDesc, nil, rootBody,
+		&transformer.RequestOptions{ContentType: writer.FormDataContentType()})
+	require.NoError(t, err)
+	require.True(t, proto.Equal(wrapperspb.Bytes([]byte{0x89, 'P', 'N', 'G'}), request))
+
+	_, err = transformer.GetRPCRequestWithOptions(body.Bytes(), msgDesc, nil, rootBody,
+		&transformer.RequestOptions{ContentType: writer.FormDataContentType(), MaxPartSize: 2})
+	require.ErrorIs(t, err, transformer.PartTooLarge)
+
+	body.Reset()
+	writer = multipart.NewWriter(&body)
+	require.NoError(t, writer.WriteField("unknown", "1"))
+	require.NoError(t, writer.WriteField("value", "cG5n"))
+	require.NoError(t, writer.Close())
+
+	request, err = transformer.GetRPCRequestWithOptions(body.Bytes(), msgDesc, nil, rootBody,
+		&transformer.RequestOptions{ContentType: writer.FormDataContentType(), IgnoreUnknownFields: true})
+	require.NoError(t, err)
+	require.True(t, proto.Equal(wrapperspb.Bytes([]byte("png")), request), "parts following ignored unknown part are kept")
+}
+
+func TestBytesParamTransform(t *testing.T) {
+	msgDesc := (&wrapperspb.BytesValue{}).ProtoReflect().Descriptor()
+	noBody := transformer.HTTPBodyRule{}
+	expected := wrapperspb.Bytes([]byte{0xfb, 0xff, 0xbf})
+
+	for _, value := range []string{"+/+/", "-_-_"} {
+		params := []transformer.Variable{{FieldPath: []string{"value"}, Value: value}}
+		request, err := transformer.GetRPCRequest(nil, msgDesc, params, noBody)
+		require.NoError(t, err, value)
+		require.True(t, proto.Equal(expected, request), value)
+	}
+
+	for _, value := range []string{"aGk=", "aGk"} {
+		params := []transformer.Variable{{FieldPath: []string{"value"}, Value: value}}
+		request, err := transformer.GetRPCRequest(nil, msgDesc, params, noBody)
+		require.NoError(t, err, value)
+		require.True(t, proto.Equal(wrapperspb.Bytes([]byte("hi")), request), value)
+	}
+
+	params := []transformer.Variable{{FieldPath: []string{"value"}, Value: "aGk"}}
+	request, err := transformer.GetRPCRequestWithOptions(nil, msgDesc, params, noBody, &transformer.RequestOptions{RawBytes: true})
+	require.NoError(t, err)
+	require.True(t, proto.Equal(wrapperspb.Bytes([]byte("aGk")), request))
+
+	params = []transformer.Variable{{FieldPath: []string{"value"}, Value: "not base64"}}
+	_, err = transformer.GetRPCRequest(nil, msgDesc, params, noBody)
+	require.ErrorIs(t, err, transformer.InvalidValue)
+}
+
 func TestRepeatableTransform(t *testing.T) {
 	msg := userpb.Summary{}
 	msgDesc := msg.ProtoReflect().Descriptor()
@@ -79,3 +250,192 @@ func TestRepeatableTransform(t *testing.T) {
 		transformer.HTTPBodyRule{RuleType: transformer.FieldPathRule, FieldPath: []string{"usernames"}})
 	require.NoError(t, err)
 }
+
+func TestProtobufBodyTransform(t *testing.T) {
+	msgDesc := (&userpb.GetUserRequest{}).ProtoReflect().Descriptor()
+
+	body, err := proto.Marshal(&userpb.GetUserRequest{Username: "John"})
+	require.NoError(t, err)
+
+	request, err := transformer.GetRPCRequestWithOptions(body, msgDesc, []transformer.Variable{},
+		transformer.HTTPBodyRule{RuleType: transformer.MapRootRule}, &transformer.RequestOptions{ContentType: "application/x-protobuf"})
+	require.NoError(t, err)
+	require.Equal(t, "John", request.Get(msgDesc.Fields().ByName("username")).String())
+
+	_, err = transformer.GetRPCRequestWithOptions([]byte("{\"username\":\"John\"}"), msgDesc, []transformer.Variable{},
+		transformer.HTTPBodyRule{RuleType: transformer.MapRootRule}, &transformer.RequestOptions{ContentType: "application/json; charset=utf-8"})
+	require.NoError(t, err)
+
+	// text/plain is decoded as JSON
+	_, err = transformer.GetRPCRequestWithOptions(body, msgDesc, []transformer.Variable{},
+		transformer.HTTPBodyRule{RuleType: transformer.MapRootRule}, &transformer.RequestOptions{ContentType: "text/plain"})
+	var bodyErr *transformer.BodyError
+	require.ErrorAs(t, err, &bodyErr)
+
+	request, err = transformer.GetRPCRequestWithOptions([]byte("{\"username\":\"John\"}"), msgDesc, []transformer.Variable{},
+		transformer.HTTPBodyRule{RuleType: transformer.MapRootRule}, &transformer.RequestOptions{ContentType: "text/plain"})
+	require.NoError(t, err)
+	require.Equal(t, "John", request.Get(msgDesc.Fields().ByName("username")).String())
+
+	_, err = transformer.GetRPCRequestWithOptions([]byte("<username>John</username>"), msgDesc, []transformer.Variable{},
+		transformer.HTTPBodyRule{RuleType: transformer.MapRootRule}, &transformer.RequestOptions{ContentType: "application/xml"})
+	require.ErrorIs(t, err, transformer.UnsupportedContentType)
+}
+
+func TestGetBodyFormat(t *testing.T) {
+	tests := []struct {
+		contentType string
+		format      transformer.BodyFormat
+		supported   bool
+	}{
+		{"", transformer.JSONBodyFormat, true},
+		{"application/json; charset=utf-8", transformer.JSONBodyFormat, true},
+		{"application/merge-patch+json", transformer.JSONBodyFormat, true},
+		{"text/plain", transformer.JSONBodyFormat, true},
+		{"application/protobuf", transformer.ProtobufBodyFormat, true},
+		{"application/x-protobuf", transformer.ProtobufBodyFormat, true},
+		{"application/x-www-form-urlencoded", transformer.FormBodyFormat, true},
+		{"multipart/form-data; boundary=x", transformer.MultipartBodyFormat, true},
+		{"application/xml", transformer.JSONBodyFormat, false},
+		{"application/json; charset", transformer.JSONBodyFormat, false},
+	}
+
+	for _, test := range tests {
+		format, err := transformer.GetBodyFormat(test.contentType)
+		if !test.supported {
+			require.ErrorIs(t, err, transformer.UnsupportedContentType, test.contentType)
+			continue
+		}
+		require.NoError(t, err, test.contentType)
+		require.Equal(t, test.format, format, test.contentType)
+	}
+}
+
+func TestMapAndRepeatedTransform(t *testing.T) {
+	msgDesc := (&userpb.GetUsersResponse{}).ProtoReflect().Descriptor()
+
+	request, err := transformer.GetRPCRequest(nil, msgDesc, []transformer.Variable{
+		{FieldPath: transformer.ParseFieldPath("users[1].username"), Value: "John"},
+		{FieldPath: transformer.ParseFieldPath("users.0.address.city"), Value: "Paris"},
+		{FieldPath: transformer.ParseFieldPath("users[0].post"), Value: "NEWS_TRENDING"},
+		{FieldPath: transformer.ParseFieldPath("users[1].post"), Value: "2"},
+	}, transformer.HTTPBodyRule{RuleType: transformer.NoBodyRule})
+	require.NoError(t, err)
+
+	users := &userpb.GetUsersResponse{}
+	data, err := proto.Marshal(request)
+	require.NoError(t, err)
+	require.NoError(t, proto.Unmarshal(data, users))
+	require.Len(t, users.GetUsers(), 2)
+	require.Equal(t, "Paris", users.GetUsers()[0].GetAddress().GetCity())
+	require.Equal(t, userpb.Post_NEWS_TRENDING, users.GetUsers()[0].GetPost())
+	require.Equal(t, "John", users.GetUsers()[1].GetUsername())
+	require.Equal(t, userpb.Post_PROMOTION, users.GetUsers()[1].GetPost())
+
+	_, err = transformer.GetRPCRequest(nil, msgDesc, []transformer.Variable{
+		{FieldPath: transformer.ParseFieldPath("users[0].post"), Value: "UNKNOWN"},
+	}, transformer.HTTPBodyRule{RuleType: transformer.NoBodyRule})
+	require.ErrorContains(t, err, "invalid value UNKNOWN of enum user.v1.Post")
+
+	_, err = transformer.GetRPCRequest(nil, msgDesc, []transformer.Variable{
+		{FieldPath: transformer.ParseFieldPath("users[x].username"), Value: "John"},
+	}, transformer.HTTPBodyRule{RuleType: transformer.NoBodyRule})
+	require.Error(t, err)
+
+	var fieldErr *transformer.FieldError
+	_, err = transformer.GetRPCRequest(nil, msgDesc, []transformer.Variable{
+		{FieldPath: transformer.ParseFieldPath("users[0].username"), Value: "John"},
+		{FieldPath: transformer.ParseFieldPath("users[999].username"), Value: "Diego"},
+	}, transformer.HTTPBodyRule{RuleType: transformer.NoBodyRule})
+	require.ErrorAs(t, err, &fieldErr, "elements cannot be skipped")
+	require.ErrorIs(t, err, transformer.InvalidFieldPath)
+
+	params := make([]transformer.Variable, 0, 11)
+	for i := 10; i >= 0; i-- {
+		params = append(params, transformer.Variable{FieldPath: transformer.ParseFieldPath(fmt.Sprintf("users[%d].username", i))})
+	}
+	request, err = transformer.GetRPCRequest(nil, msgDesc, params, transformer.HTTPBodyRule{RuleType: transformer.NoBodyRule})
+	require.NoError(t, err, "indexes are applied in numeric order")
+	require.Equal(t, 11, request.Get(msgDesc.Fields().ByName("users")).List().Len())
+
+	summaryDesc := (&userpb.Summary{}).ProtoReflect().Descriptor()
+	request, err = transformer.GetRPCRequest(nil, summaryDesc, []transformer.Variable{
+		{FieldPath: []string{"usernames"}, Value: "John,Diego", CommaSeparated: true},
+		{FieldPath: []string{"usernames"}, Value: "Alberto"},
+		{FieldPath: []string{"countries"}, Value: "Bosnia and Herzegovina, Republic of"},
+	}, transformer.HTTPBodyRule{RuleType: transformer.NoBodyRule})
+	require.NoError(t, err)
+	require.Equal(t, 3, request.Get(summaryDesc.Fields().ByName("usernames")).List().Len())
+	require.Equal(t, 1, request.Get(summaryDesc.Fields().ByName("countries")).List().Len(), "only query values are split")
+
+	request, err = transformer.GetRPCRequest([]byte("John,Diego"), summaryDesc, nil,
+		transformer.HTTPBodyRule{RuleType: transformer.FieldPathRule, FieldPath: []string{"usernames"}})
+	require.NoError(t, err)
+	require.Equal(t, 1, request.Get(summaryDesc.Fields().ByName("usernames")).List().Len(), "body is not split")
+
+	structDesc := (&structpb.Struct{}).ProtoReflect().Descriptor()
+	request, err = transformer.GetRPCRequest(nil, structDesc, []transformer.Variable{
+		{FieldPath: transformer.ParseFieldPath("fields[env]"), Value: "prod"},
+		{FieldPath: transformer.ParseFieldPath("fields.region"), Value: "eu"},
+		{FieldPath: transformer.ParseFieldPath("fields[app.kubernetes.io/name]"), Value: "proxy"},
+	}, transformer.HTTPBodyRule{RuleType: transformer.NoBodyRule})
+	require.NoError(t, err)
+	fields := request.Get(structDesc.Fields().ByName("fields")).Map()
+	require.Equal(t, 3, fields.Len())
+	require.True(t, fields.Has(protoreflect.ValueOfString("app.kubernetes.io/name").MapKey()), "map key can contain dots")
+}
+
+func TestValidateFieldPath(t *testing.T) {
+	msgDesc := (&userpb.GetUsersResponse{}).ProtoReflect().Descriptor()
+
+	require.NoError(t, transformer.ValidateFieldPath(msgDesc, []string{"users"}))
+	require.NoError(t, transformer.ValidateFieldPath(msgDesc, []string{"users", "0", "address", "city"}))
+	require.ErrorIs(t, transformer.ValidateFieldPath(msgDesc, []string{"users", "city"}), transformer.InvalidFieldPath)
+	require.ErrorIs(t, transformer.ValidateFieldPath(msgDesc, []string{"users", "0"}), transformer.InvalidFieldPath)
+	require.ErrorIs(t, transformer.ValidateFieldPath(msgDesc, []string{"users", "0", "unknown"}), transformer.UnknownField)
+}
+
+func TestParseFieldPath(t *testing.T) {
+	require.Equal(t, []string{"labels", "env"}, transformer.ParseFieldPath("labels[env]"))
+	require.Equal(t, []string{"labels", "env"}, transformer.ParseFieldPath("labels.env"))
+	require.Equal(t, []string{"items", "0", "name"}, transformer.ParseFieldPath("items[0].name"))
+	require.Equal(t, []string{"a", "b", "c"}, transformer.ParseFieldPath("a[b][c]"))
+	require.Equal(t, []string{"labels", "app.kubernetes.io/name"}, transformer.ParseFieldPath("labels[app.kubernetes.io/name]"))
+	require.Equal(t, []string{"labels", "a]b", "c"}, transformer.ParseFieldPath("labels[a]b].c"))
+	require.Equal(t, []string{"labels", "[x]"}, transformer.ParseFieldPath("labels[[x]]"))
+	require.Equal(t, []string{"labels[env"}, transformer.ParseFieldPath("labels[env"))
+	require.Equal(t, []string{"username"}, transformer.ParseFieldPath("username"))
+}
+
+func TestResolveFieldPath(t *testing.T) {
+	msgDesc := (&userpb.GetUsersResponse{}).ProtoReflect().Descriptor()
+
+	resolve := func(naming transformer.FieldNaming, fieldPath ...string) []string {
+		resolved, ok := transformer.ResolveFieldPath(msgDesc, fieldPath, naming)
+		if !ok {
+			return nil
+		}
+		return resolved
+	}
+
+	require.Equal(t, []string{"users"}, resolve(transformer.FieldNamingBoth, "users"))
+	require.Equal(t, []string{"users", "0", "address", "city"}, resolve(transformer.FieldNamingBoth, "users", "0", "address", "city"))
+	require.Nil(t, resolve(transformer.FieldNamingBoth, "users", "0"))
+	require.Nil(t, resolve(transformer.FieldNamingBoth, "users", "0", "unknown"))
+	require.Nil(t, resolve(transformer.FieldNamingBoth, "unknown"))
+
+	countryCode := []string{"users", "0", "address", "country_code"}
+	require.Equal(t, countryCode, resolve(transformer.FieldNamingBoth, "users", "0", "address", "countryCode"))
+	require.Equal(t, countryCode, resolve(transformer.FieldNamingBoth, "users", "0", "address", "country_code"))
+	require.Equal(t, countryCode, resolve(transformer.FieldNamingJSON, "users", "0", "address", "countryCode"))
+	require.Nil(t, resolve(transformer.FieldNamingJSON, "users", "0", "address", "country_code"))
+	require.Equal(t, countryCode, resolve(transformer.FieldNamingProto, "users", "0", "address", "country_code"))
+	require.Nil(t, resolve(transformer.FieldNamingProto, "users", "0", "address", "countryCode"))
+
+	structDesc := (&structpb.Struct{}).ProtoReflect().Descriptor()
+	resolved, ok := transformer.ResolveFieldPath(structDesc, []string{"fields", "env"}, transformer.FieldNamingBoth)
+	require.True(t, ok)
+	require.Equal(t, []string{"fields", "env"}, resolved)
+	_, ok = transformer.ResolveFieldPath(structDesc, []string{"fields"}, transformer.FieldNamingBoth)
+	require.False(t, ok)
+}
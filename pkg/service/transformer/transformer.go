@@ -64,17 +64,23 @@ func GetRPCRequestContext(request *http.Request) context.Context {
 	return metadata.NewOutgoingContext(request.Context(), grpcMetadata)
 }
 
-func SetRESTHeaders(protoMajor int, headers http.Header, gRPCheader metadata.MD, gRPCTrailer metadata.MD) {
-	// set headers
+// SetRESTHeaders sets gRPC header as HTTP headers together with content type. Trailers are converted
+// separately by GetRESTTrailers.
+func SetRESTHeaders(protoMajor int, headers http.Header, gRPCheader metadata.MD, contentType string) {
 	for name, values := range gRPCheader {
 		setHeader(headers, protoMajor, name, values)
 	}
-	// append trailers as headers
+
+	headers.Set(headerContentType, contentType)
+}
+
+// GetRESTTrailers converts gRPC trailer to HTTP trailers following the same rules as SetRESTHeaders.
+func GetRESTTrailers(protoMajor int, gRPCTrailer metadata.MD) http.Header {
+	trailers := make(http.Header, len(gRPCTrailer))
 	for name, values := range gRPCTrailer {
-		setHeader(headers, protoMajor, name, values)
+		setHeader(trailers, protoMajor, name, values)
 	}
-
-	headers.Set(headerContentType, "application/json")
+	return trailers
 }
 
 func GetRPCResponse(responseDesc protoreflect.MessageDescriptor) *dynamicpb.Message {
@@ -125,6 +131,42 @@ func GetHTTPStatusCode(code codes.Code) int {
 	}
 }
 
+// GetGRPCCode returns gRPC code of the error originating in the proxy itself, e.g. unknown route.
+//
+//nolint:mnd
+func GetGRPCCode(httpCode int) codes.Code {
+	switch httpCode {
+	case http.StatusOK:
+		return codes.OK
+	case 499:
+		return codes.Canceled
+	case http.StatusBadRequest, http.StatusNotAcceptable, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusInternalServerError:
+		return codes.Internal
+	default:
+		return codes.Unknown
+	}
+}
+
 func setHeader(headers http.Header, protoMajor int, name string, values []string) {
 	// content-length header will be not processing
 	if name == headerContentLength {
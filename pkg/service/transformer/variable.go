@@ -4,7 +4,11 @@
 package transformer
 
 import (
+	"cmp"
+	"encoding/base64"
+	"slices"
 	"strconv"
+	"strings"
 
 	jErrors "github.com/juju/errors"
 	"google.golang.org/protobuf/encoding/protojson"
@@ -15,9 +19,22 @@ import (
 
 const errUnsupportedFieldType jErrors.ConstError = "unsupported field type"
 
+// valueOptions control how text values of parameters, form fields and the body bound to a field are converted
+// to values of fields.
+type valueOptions struct {
+	// bytes are taken as they are instead of being decoded from base64
+	rawBytes bool
+	// messages, including well-known types, are decoded from JSON only
+	json bool
+	// values of repeated scalar fields are separated by comma
+	splitLists bool
+}
+
 type Variable struct {
 	FieldPath []string
 	Value     string
+	// value holds comma separated values of repeated scalar field, e.g. query parameter ?ids=1,2
+	CommaSeparated bool
 }
 
 func ValidateFieldPath(desc protoreflect.MessageDescriptor, fieldPath []string) error {
@@ -47,71 +64,320 @@ func findFieldByName(protoDesc protoreflect.MessageDescriptor, fieldName protore
 	return nil
 }
 
-func setVariables(request *dynamicpb.Message, params []Variable) error {
+func setVariables(request *dynamicpb.Message, params []Variable, opts valueOptions) error {
 	if len(params) == 0 {
 		return nil
 	}
 
+	// elements of repeated fields are appended in order of their indexes
+	params = slices.Clone(params)
+	slices.SortStableFunc(params, func(a, b Variable) int { return compareFieldPaths(a.FieldPath, b.FieldPath) })
+
 	for _, param := range params {
-		err := insertValueByPath(request, param.FieldPath, param.Value)
+		opts.splitLists = param.CommaSeparated
+		err := insertValueByPath(request, param.FieldPath, param.Value, opts)
 		if err != nil {
-			return jErrors.Trace(err)
+			return newFieldError(param.FieldPath, err)
+		}
+	}
+
+	return nil
+}
+
+// insertValueByPath sets value of the field addressed by path. Path may go through map fields, whose next
+// segment is the map key, and through repeated message fields, whose next segment is the index of the element.
+// Value is converted to the field type according to opts.
+func insertValueByPath(msg *dynamicpb.Message, fieldPath []string, value string, opts valueOptions) error {
+	if len(fieldPath) == 0 {
+		return jErrors.Trace(InvalidFieldPath)
+	}
+
+	var currentMsg protoreflect.Message = msg
+	for idx := 0; idx < len(fieldPath); idx++ {
+		name := fieldPath[idx]
+		field := findFieldByName(currentMsg.Descriptor(), protoreflect.Name(name))
+		if field == nil {
+			return jErrors.Annotatef(UnknownField, "%s", name)
+		}
+
+		rest := fieldPath[idx+1:]
+		switch {
+		case field.IsMap():
+			if len(rest) == 0 {
+				return jErrors.Annotatef(InvalidFieldPath, "key of map field %s is missing", name)
+			}
+			if len(rest) == 1 {
+				return jErrors.Trace(setMapValue(currentMsg, field, rest[0], value, opts))
+			}
+			entry, err := mutableMapEntry(currentMsg, field, rest[0])
+			if err != nil {
+				return jErrors.Trace(err)
+			}
+			currentMsg = entry
+			idx++
+		case field.IsList():
+			if len(rest) == 0 {
+				return jErrors.Trace(appendListValues(currentMsg, field, value, opts))
+			}
+			element, err := mutableListElement(currentMsg, field, rest[0])
+			if err != nil {
+				return jErrors.Trace(err)
+			}
+			if len(rest) == 1 {
+				return jErrors.Annotatef(InvalidFieldPath, "field of element of %s is missing", name)
+			}
+			currentMsg = element
+			idx++
+		case len(rest) == 0:
+			return jErrors.Trace(setValueToField(currentMsg, field, value, opts))
+		case field.Kind() == protoreflect.MessageKind:
+			currentMsg = currentMsg.Mutable(field).Message()
+		default:
+			return jErrors.Annotatef(InvalidFieldPath, "field %s is not a message", name)
 		}
 	}
 
 	return nil
 }
 
-func insertValueByPath(msg *dynamicpb.Message, fieldPath []string, value string) error {
-	currentMsg, fieldDesc, err := findInnerField(msg, fieldPath)
+func setMapValue(msg protoreflect.Message, field protoreflect.FieldDescriptor, key, value string, opts valueOptions) error {
+	mapKey, err := valueOfFieldType(field.MapKey(), key)
+	if err != nil {
+		return jErrors.Annotatef(err, "key of map field %s", field.Name())
+	}
+	mapValue, err := valueOfParam(field.MapValue(), value, opts)
 	if err != nil {
 		return jErrors.Trace(err)
 	}
 
-	return jErrors.Trace(setValueToField(currentMsg, fieldDesc, value))
+	msg.Mutable(field).Map().Set(mapKey.MapKey(), mapValue)
+	return nil
 }
 
-func findInnerField(msg protoreflect.Message, fieldPath []string) (protoreflect.Message, protoreflect.FieldDescriptor, error) {
-	if len(fieldPath) == 0 {
-		return nil, nil, jErrors.New("field path is empty")
+func mutableMapEntry(msg protoreflect.Message, field protoreflect.FieldDescriptor, key string) (protoreflect.Message, error) {
+	if field.MapValue().Kind() != protoreflect.MessageKind {
+		return nil, jErrors.Annotatef(InvalidFieldPath, "value of map field %s is not a message", field.Name())
 	}
+	mapKey, err := valueOfFieldType(field.MapKey(), key)
+	if err != nil {
+		return nil, jErrors.Annotatef(err, "key of map field %s", field.Name())
+	}
+	return msg.Mutable(field).Map().Mutable(mapKey.MapKey()).Message(), nil
+}
 
-	var currentMsg protoreflect.Message = msg
-	// Iterate over all fields except the last one, which is the field to set.
-	// Last field is processed separately because it requires a different handling.
-	for _, field := range fieldPath[:len(fieldPath)-1] {
-		fieldDescriptor := findFieldByName(currentMsg.Descriptor(), protoreflect.Name(field))
-		if fieldDescriptor == nil {
-			return nil, nil, jErrors.Errorf("field %s not found", field)
+// appendListValues appends value to repeated field, values of scalar fields are split by comma when opts allow it.
+func appendListValues(msg protoreflect.Message, field protoreflect.FieldDescriptor, value string, opts valueOptions) error {
+	values := []string{value}
+	if opts.splitLists && field.Kind() != protoreflect.MessageKind {
+		values = strings.Split(value, ",")
+	}
+
+	for _, v := range values {
+		if err := setValueToField(msg, field, v, opts); err != nil {
+			return jErrors.Trace(err)
 		}
+	}
+	return nil
+}
+
+func mutableListElement(msg protoreflect.Message, field protoreflect.FieldDescriptor, index string) (protoreflect.Message, error) {
+	if field.Kind() != protoreflect.MessageKind {
+		return nil, jErrors.Annotatef(InvalidFieldPath, "elements of repeated field %s are not messages", field.Name())
+	}
 
-		if fieldDescriptor.Kind() != protoreflect.MessageKind {
-			return nil, nil, jErrors.New("field type must be message")
+	// index may address existing element or append the next one, elements cannot be skipped
+	list := msg.Mutable(field).List()
+	idx, err := strconv.Atoi(index)
+	if err != nil || idx < 0 || idx > list.Len() {
+		return nil, jErrors.Annotatef(InvalidFieldPath, "invalid index %s of repeated field %s with %d elements", index, field.Name(), list.Len())
+	}
+
+	if idx == list.Len() {
+		list.Append(list.NewElement())
+	}
+	return list.Get(idx).Message(), nil
+}
+
+// compareFieldPaths orders field paths segment by segment, numeric segments like list indexes are compared
+// as numbers.
+func compareFieldPaths(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		x, errX := strconv.Atoi(a[i])
+		y, errY := strconv.Atoi(b[i])
+		if errX == nil && errY == nil {
+			if c := cmp.Compare(x, y); c != 0 {
+				return c
+			}
+			continue
+		}
+		if c := strings.Compare(a[i], b[i]); c != 0 {
+			return c
 		}
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+// FieldNaming decides which names of fields are accepted in field paths of query parameters.
+type FieldNaming string
 
-		if fieldDescriptor.Cardinality() == protoreflect.Repeated {
-			return nil, nil, jErrors.New("repeated fields are not supported")
+const (
+	// FieldNamingBoth accepts both proto names and JSON names, proto name takes precedence on conflict
+	FieldNamingBoth FieldNaming = "both"
+	// FieldNamingProto accepts proto names only, e.g. page_size
+	FieldNamingProto FieldNaming = "proto"
+	// FieldNamingJSON accepts JSON names only, e.g. pageSize
+	FieldNamingJSON FieldNaming = "json"
+)
+
+// findFieldByNaming looks field up by its proto or JSON name according to naming, both names are accepted
+// when naming is empty.
+func findFieldByNaming(desc protoreflect.MessageDescriptor, name string, naming FieldNaming) protoreflect.FieldDescriptor {
+	if naming != FieldNamingJSON {
+		if field := findFieldByName(desc, protoreflect.Name(name)); field != nil {
+			return field
 		}
+	}
+	if naming != FieldNamingProto {
+		// fields of oneofs are listed among fields of the message as well
+		return desc.Fields().ByJSONName(name)
+	}
+	return nil
+}
+
+// ResolveFieldPath resolves names of fields in the path according to naming and returns the path with proto
+// names. Map keys and list indexes are kept as they are. It returns false when the path does not address
+// any field of the message.
+func ResolveFieldPath(desc protoreflect.MessageDescriptor, fieldPath []string, naming FieldNaming) ([]string, bool) {
+	resolved := make([]string, len(fieldPath))
+	copy(resolved, fieldPath)
+
+	for idx := 0; idx < len(fieldPath); idx++ {
+		field := findFieldByNaming(desc, fieldPath[idx], naming)
+		if field == nil {
+			return nil, false
+		}
+		resolved[idx] = string(field.Name())
+
+		rest := fieldPath[idx+1:]
+		switch {
+		case field.IsMap():
+			if len(rest) <= 1 {
+				return resolved, len(rest) == 1
+			}
+			if field.MapValue().Kind() != protoreflect.MessageKind {
+				return nil, false
+			}
+			desc = field.MapValue().Message()
+			idx++
+		case field.IsList():
+			if len(rest) == 0 {
+				return resolved, true
+			}
+			if len(rest) == 1 || field.Kind() != protoreflect.MessageKind {
+				return nil, false
+			}
+			desc = field.Message()
+			idx++
+		case len(rest) == 0:
+			return resolved, true
+		case field.Kind() == protoreflect.MessageKind:
+			desc = field.Message()
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
 
-		innerMsg := currentMsg.Mutable(fieldDescriptor).Message()
-		if innerMsg == nil {
-			return nil, nil, jErrors.Errorf("field %s is nil", field)
+// ParseFieldPath splits name of query parameter into field path. Both dots and brackets separate segments,
+// e.g. labels[env], labels.env or items[0].name. Keys in brackets are taken as they are, so they can contain
+// dots and brackets, e.g. labels[app.kubernetes.io/name]. Key ends by bracket followed by another segment.
+func ParseFieldPath(name string) []string {
+	var fieldPath []string
+	start := 0
+	afterKey := false
+	for idx := 0; idx < len(name); idx++ {
+		switch name[idx] {
+		case '.':
+			if !afterKey {
+				fieldPath = append(fieldPath, name[start:idx])
+			}
+			start = idx + 1
+			afterKey = false
+		case '[':
+			end := closingBracket(name, idx+1)
+			if end < 0 {
+				// unterminated key is part of the segment
+				return append(fieldPath, name[start:])
+			}
+			if !afterKey {
+				fieldPath = append(fieldPath, name[start:idx])
+			}
+			fieldPath = append(fieldPath, name[idx+1:end])
+			idx = end
+			start = end + 1
+			afterKey = true
 		}
+	}
 
-		currentMsg = innerMsg
+	if !afterKey {
+		fieldPath = append(fieldPath, name[start:])
 	}
+	return fieldPath
+}
 
-	lastField := fieldPath[len(fieldPath)-1]
-	lastFieldDescriptor := findFieldByName(currentMsg.Descriptor(), protoreflect.Name(lastField))
-	if lastFieldDescriptor == nil {
-		return nil, nil, jErrors.Errorf("field %s not found", lastField)
+// closingBracket returns index of bracket closing the key starting at given index or -1 when it is not closed.
+func closingBracket(name string, start int) int {
+	for idx := start; idx < len(name); idx++ {
+		if name[idx] == ']' && (idx+1 == len(name) || name[idx+1] == '.' || name[idx+1] == '[') {
+			return idx
+		}
+	}
+	return -1
+}
+
+// findInnerField returns the field addressed by path together with the message containing it. Path goes through
+// map and repeated message fields the same way as path of insertValueByPath.
+func findInnerField(msg protoreflect.Message, fieldPath []string) (protoreflect.Message, protoreflect.FieldDescriptor, error) {
+	if len(fieldPath) == 0 {
+		return nil, nil, jErrors.Trace(InvalidFieldPath)
+	}
+
+	currentMsg := msg
+	for idx := 0; idx < len(fieldPath); idx++ {
+		name := fieldPath[idx]
+		field := findFieldByName(currentMsg.Descriptor(), protoreflect.Name(name))
+		if field == nil {
+			return nil, nil, jErrors.Annotatef(UnknownField, "%s", name)
+		}
+
+		rest := fieldPath[idx+1:]
+		var err error
+		switch {
+		case len(rest) == 0:
+			return currentMsg, field, nil
+		case field.IsMap():
+			currentMsg, err = mutableMapEntry(currentMsg, field, rest[0])
+			idx++
+		case field.IsList():
+			currentMsg, err = mutableListElement(currentMsg, field, rest[0])
+			idx++
+		case field.Kind() == protoreflect.MessageKind:
+			currentMsg = currentMsg.Mutable(field).Message()
+		default:
+			return nil, nil, jErrors.Annotatef(InvalidFieldPath, "field %s is not a message", name)
+		}
+		if err != nil {
+			return nil, nil, jErrors.Trace(err)
+		}
 	}
 
-	return currentMsg, lastFieldDescriptor, nil
+	// path ends by key or index, which addresses an element instead of a field
+	return nil, nil, jErrors.Annotatef(InvalidFieldPath, "field of element of %s is missing", fieldPath[len(fieldPath)-2])
 }
 
-func setValueToField(msg protoreflect.Message, field protoreflect.FieldDescriptor, value string) error {
-	fieldValue, err := valueOfFieldType(field, value)
+func setValueToField(msg protoreflect.Message, field protoreflect.FieldDescriptor, value string, opts valueOptions) error {
+	fieldValue, err := valueOfParam(field, value, opts)
 	if err != nil {
 		return jErrors.Trace(err)
 	}
@@ -130,6 +396,17 @@ func setValueToField(msg protoreflect.Message, field protoreflect.FieldDescripto
 	return jErrors.New("only list or non-repeatable types are supported")
 }
 
+// valueOfParam converts value of parameter to the field type according to opts.
+func valueOfParam(field protoreflect.FieldDescriptor, fieldValue string, opts valueOptions) (protoreflect.Value, error) {
+	switch {
+	case opts.rawBytes && field.Kind() == protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes([]byte(fieldValue)), nil
+	case opts.json && field.Kind() == protoreflect.MessageKind:
+		return valueOfJSONMessage(field, fieldValue)
+	}
+	return valueOfFieldType(field, fieldValue)
+}
+
 func valueOfFieldType(field protoreflect.FieldDescriptor, fieldValue string) (protoreflect.Value, error) { //nolint: gocyclo, funlen
 	stringValue := protoreflect.ValueOfString(fieldValue)
 
@@ -177,18 +454,24 @@ func valueOfFieldType(field protoreflect.FieldDescriptor, fieldValue string) (pr
 		}
 		return protoreflect.ValueOfFloat64(value), nil
 	case protoreflect.EnumKind:
-		return protoreflect.ValueOfEnum(field.Enum().Values().ByName(protoreflect.Name(fieldValue)).Number()), nil
+		return valueOfEnum(field.Enum(), fieldValue)
 	case protoreflect.StringKind:
 		return stringValue, nil
 	case protoreflect.BytesKind:
-		return protoreflect.ValueOfBytes([]byte(fieldValue)), nil
-	case protoreflect.MessageKind:
-		protoMsg := dynamicpb.NewMessage(field.Message())
-		err := protojson.Unmarshal([]byte(fieldValue), proto.Message(protoMsg))
+		value, err := decodeBase64(fieldValue)
 		if err != nil {
-			return stringValue, jErrors.Annotate(err, "parse message param")
+			return stringValue, jErrors.Annotate(err, "parse bytes param")
+		}
+		return protoreflect.ValueOfBytes(value), nil
+	case protoreflect.MessageKind:
+		wellKnownMsg, ok, err := parseWellKnownType(field.Message(), fieldValue)
+		if ok {
+			if err != nil {
+				return stringValue, jErrors.Trace(err)
+			}
+			return protoreflect.ValueOfMessage(wellKnownMsg), nil
 		}
-		return protoreflect.ValueOfMessage(protoMsg), nil
+		return valueOfJSONMessage(field, fieldValue)
 	case protoreflect.GroupKind:
 		return stringValue, errUnsupportedFieldType
 	}
@@ -196,6 +479,44 @@ func valueOfFieldType(field protoreflect.FieldDescriptor, fieldValue string) (pr
 	return stringValue, errUnsupportedFieldType
 }
 
+// valueOfJSONMessage decodes message from its JSON representation, e.g. "1.5s" for google.protobuf.Duration.
+func valueOfJSONMessage(field protoreflect.FieldDescriptor, fieldValue string) (protoreflect.Value, error) {
+	stringValue := protoreflect.ValueOfString(fieldValue)
+	if err := validateJSON([]byte(fieldValue)); err != nil {
+		return stringValue, jErrors.Annotate(err, "parse message param")
+	}
+
+	protoMsg := dynamicpb.NewMessage(field.Message())
+	if err := protojson.Unmarshal([]byte(fieldValue), proto.Message(protoMsg)); err != nil {
+		return stringValue, jErrors.Annotate(err, "parse message param")
+	}
+	return protoreflect.ValueOfMessage(protoMsg), nil
+}
+
+// decodeBase64 decodes standard or URL-safe base64 with or without padding as proto3 JSON mapping requires.
+func decodeBase64(value string) ([]byte, error) {
+	value = strings.TrimRight(value, "=")
+	if strings.ContainsAny(value, "-_") {
+		data, err := base64.RawURLEncoding.DecodeString(value)
+		return data, jErrors.Trace(err)
+	}
+	data, err := base64.RawStdEncoding.DecodeString(value)
+	return data, jErrors.Trace(err)
+}
+
+// valueOfEnum accepts name or number of enum value.
+func valueOfEnum(enum protoreflect.EnumDescriptor, fieldValue string) (protoreflect.Value, error) {
+	if value := enum.Values().ByName(protoreflect.Name(fieldValue)); value != nil {
+		return protoreflect.ValueOfEnum(value.Number()), nil
+	}
+
+	number, err := strconv.ParseInt(fieldValue, 10, 32)
+	if err == nil && enum.Values().ByNumber(protoreflect.EnumNumber(number)) != nil {
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(number)), nil
+	}
+	return protoreflect.ValueOfString(fieldValue), jErrors.Errorf("invalid value %s of enum %s", fieldValue, enum.FullName())
+}
+
 func validateFieldType(field protoreflect.FieldDescriptor) error {
 	switch field.Kind() {
 	case protoreflect.BoolKind,
@@ -0,0 +1,127 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package transformer
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	jErrors "github.com/juju/errors"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	timestampName = "google.protobuf.Timestamp"
+	durationName  = "google.protobuf.Duration"
+	fieldMaskName = "google.protobuf.FieldMask"
+	structName    = "google.protobuf.Struct"
+	listValueName = "google.protobuf.ListValue"
+	valueName     = "google.protobuf.Value"
+)
+
+// wrapperNames are scalar wrappers which are parsed as their wrapped value.
+var wrapperNames = map[protoreflect.FullName]bool{
+	"google.protobuf.DoubleValue": true,
+	"google.protobuf.FloatValue":  true,
+	"google.protobuf.Int64Value":  true,
+	"google.protobuf.UInt64Value": true,
+	"google.protobuf.Int32Value":  true,
+	"google.protobuf.UInt32Value": true,
+	"google.protobuf.BoolValue":   true,
+	"google.protobuf.StringValue": true,
+	"google.protobuf.BytesValue":  true,
+}
+
+// parseWellKnownType parses value of path or query parameter into well-known type following grpc-gateway
+// conventions: RFC 3339 timestamps, durations like 1.5s, comma separated field masks, JSON structs
+// and plain scalar wrappers. It returns false for other message types.
+func parseWellKnownType(desc protoreflect.MessageDescriptor, value string) (protoreflect.Message, bool, error) {
+	msg := dynamicpb.NewMessage(desc)
+
+	var err error
+	switch desc.FullName() {
+	case timestampName:
+		err = setTimestamp(msg, value)
+	case durationName:
+		err = setDuration(msg, value)
+	case fieldMaskName:
+		setFieldMask(msg, value)
+	case structName, listValueName:
+		err = protojson.Unmarshal([]byte(value), msg)
+	case valueName:
+		// plain text which is not a valid JSON is taken as a string value
+		if protojson.Unmarshal([]byte(value), msg) != nil {
+			msg.Set(desc.Fields().ByName("string_value"), protoreflect.ValueOfString(value))
+		}
+	default:
+		if !wrapperNames[desc.FullName()] {
+			return nil, false, nil
+		}
+		err = setWrapper(msg, value)
+	}
+	if err != nil {
+		return nil, true, jErrors.Annotatef(err, "parse %s param", desc.Name())
+	}
+	return msg, true, nil
+}
+
+func setTimestamp(msg *dynamicpb.Message, value string) error {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return jErrors.Trace(err)
+	}
+
+	fields := msg.Descriptor().Fields()
+	msg.Set(fields.ByName("seconds"), protoreflect.ValueOfInt64(t.Unix()))
+	msg.Set(fields.ByName("nanos"), protoreflect.ValueOfInt32(int32(t.Nanosecond()))) //nolint:gosec
+	return nil
+}
+
+func setDuration(msg *dynamicpb.Message, value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return jErrors.Trace(err)
+	}
+
+	fields := msg.Descriptor().Fields()
+	msg.Set(fields.ByName("seconds"), protoreflect.ValueOfInt64(int64(d/time.Second)))
+	msg.Set(fields.ByName("nanos"), protoreflect.ValueOfInt32(int32(d%time.Second))) //nolint:gosec
+	return nil
+}
+
+// setFieldMask sets comma separated paths, lower camel case names are converted to proto names.
+func setFieldMask(msg *dynamicpb.Message, value string) {
+	paths := msg.Mutable(msg.Descriptor().Fields().ByName("paths")).List()
+	for _, path := range strings.Split(value, ",") {
+		path = strings.TrimSpace(path)
+		if path != "" {
+			paths.Append(protoreflect.ValueOfString(toSnakeCase(path)))
+		}
+	}
+}
+
+func setWrapper(msg *dynamicpb.Message, value string) error {
+	field := msg.Descriptor().Fields().ByName("value")
+	fieldValue, err := valueOfFieldType(field, value)
+	if err != nil {
+		return jErrors.Trace(err)
+	}
+	msg.Set(field, fieldValue)
+	return nil
+}
+
+func toSnakeCase(name string) string {
+	var sb strings.Builder
+	for _, c := range name {
+		if unicode.IsUpper(c) {
+			sb.WriteByte('_')
+			c = unicode.ToLower(c)
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
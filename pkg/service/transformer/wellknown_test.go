@@ -0,0 +1,69 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package transformer
+
+import (
+	"testing"
+	"time"
+
+	userpb "github.com/eset/grpc-rest-proxy/cmd/examples/grpcserver/gen/user/v1"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func parseInto(t *testing.T, target proto.Message, value string) {
+	t.Helper()
+
+	msg, ok, err := parseWellKnownType(target.ProtoReflect().Descriptor(), value)
+	require.True(t, ok)
+	require.NoError(t, err)
+
+	data, err := proto.Marshal(msg.Interface())
+	require.NoError(t, err)
+	require.NoError(t, proto.Unmarshal(data, target))
+}
+
+func TestParseWellKnownType(t *testing.T) {
+	ts := &timestamppb.Timestamp{}
+	parseInto(t, ts, "2024-01-01T10:00:00.5+02:00")
+	require.Equal(t, time.Date(2024, 1, 1, 8, 0, 0, 5e8, time.UTC), ts.AsTime())
+
+	d := &durationpb.Duration{}
+	parseInto(t, d, "1.5s")
+	require.Equal(t, 1500*time.Millisecond, d.AsDuration())
+
+	mask := &fieldmaskpb.FieldMask{}
+	parseInto(t, mask, "user.firstName, email")
+	require.Equal(t, []string{"user.first_name", "email"}, mask.GetPaths())
+
+	i32 := &wrapperspb.Int32Value{}
+	parseInto(t, i32, "-42")
+	require.Equal(t, int32(-42), i32.GetValue())
+
+	b := &wrapperspb.BoolValue{}
+	parseInto(t, b, "true")
+	require.True(t, b.GetValue())
+
+	s := &structpb.Struct{}
+	parseInto(t, s, `{"a":1}`)
+	require.InDelta(t, 1.0, s.GetFields()["a"].GetNumberValue(), 0)
+
+	v := &structpb.Value{}
+	parseInto(t, v, "text")
+	require.Equal(t, "text", v.GetStringValue())
+
+	_, ok, err := parseWellKnownType(timestamppb.File_google_protobuf_timestamp_proto.Messages().Get(0), "yesterday")
+	require.True(t, ok)
+	require.Error(t, err)
+
+	_, ok, err = parseWellKnownType((&userpb.GetUserRequest{}).ProtoReflect().Descriptor(), "a")
+	require.False(t, ok)
+	require.NoError(t, err)
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	jErrors "github.com/juju/errors"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	Gzip     = "gzip"
+	Deflate  = "deflate"
+	Zstd     = "zstd"
+	Identity = "identity"
+
+	UnsupportedEncoding = jErrors.ConstError("unsupported content encoding")
+	BodyTooLarge        = jErrors.ConstError("decoded body exceeds size limit")
+
+	// window size limit recommended by zstd format for decoders, used when body size is not limited
+	zstdMaxWindow = 8 << 20
+
+	headerContentEncoding = "Content-Encoding"
+	headerContentType     = "Content-Type"
+	headerContentLength   = "Content-Length"
+	headerVary            = "Vary"
+	headerAcceptEncoding  = "Accept-Encoding"
+	headerETag            = "ETag"
+)
+
+type Config struct {
+	Enabled bool `mapstructure:"enabled"`
+	// minimal size of response body in bytes which is compressed
+	MinSize uint `mapstructure:"minSize"`
+	// supported encodings in order of preference
+	Encodings []string `mapstructure:"encodings" validate:"dive,oneof=gzip deflate zstd"`
+	// content types of responses which are compressed, all content types when empty
+	ContentTypes []string `mapstructure:"contentTypes"`
+}
+
+// Compressor compresses response bodies using encoding negotiated with the client.
+type Compressor struct {
+	conf        *Config
+	zstdEncoder *zstd.Encoder
+}
+
+func New(conf *Config) (*Compressor, error) {
+	c := &Compressor{conf: conf}
+
+	if slices.Contains(conf.Encodings, Zstd) {
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, jErrors.Trace(err)
+		}
+		c.zstdEncoder = encoder
+	}
+
+	return c, nil
+}
+
+// Compress compresses body when the client accepts one of configured encodings and the response is eligible.
+// Header is updated accordingly, strong entity tag becomes weak as it is shared with the identity representation.
+func (c *Compressor) Compress(header http.Header, acceptEncoding string, body []byte) ([]byte, error) {
+	if uint(len(body)) < c.conf.MinSize || len(body) == 0 || header.Get(headerContentEncoding) != "" {
+		return body, nil
+	}
+
+	if !c.isCompressible(header.Get(headerContentType)) {
+		return body, nil
+	}
+
+	header.Add(headerVary, headerAcceptEncoding)
+
+	encoding := Negotiate(acceptEncoding, c.conf.Encodings)
+	if encoding == "" {
+		return body, nil
+	}
+
+	compressed, err := c.encode(encoding, body)
+	if err != nil {
+		return nil, jErrors.Trace(err)
+	}
+
+	header.Set(headerContentEncoding, encoding)
+	header.Del(headerContentLength)
+	if etag := header.Get(headerETag); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set(headerETag, "W/"+etag)
+	}
+	return compressed, nil
+}
+
+func (c *Compressor) isCompressible(contentType string) bool {
+	if len(c.conf.ContentTypes) == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(c.conf.ContentTypes, mediaType)
+}
+
+func (c *Compressor) encode(encoding string, body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var writer io.WriteCloser
+
+	switch encoding {
+	case Zstd:
+		return c.zstdEncoder.EncodeAll(body, nil), nil
+	case Gzip:
+		writer = gzip.NewWriter(&buf)
+	case Deflate:
+		writer = zlib.NewWriter(&buf)
+	default:
+		return nil, jErrors.Trace(UnsupportedEncoding)
+	}
+
+	_, err := writer.Write(body)
+	if err != nil {
+		return nil, jErrors.Trace(err)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, jErrors.Trace(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Negotiate selects encoding from Accept-Encoding header value. Encodings with the same quality are
+// selected by order of supported encodings. Empty string means that response should not be encoded.
+func Negotiate(acceptEncoding string, supported []string) string {
+	var selected string
+	var selectedQuality float64
+
+	wildcardQuality := -1.0
+	qualities := make(map[string]float64)
+
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+
+		if name == "*" {
+			wildcardQuality = quality
+			continue
+		}
+		qualities[name] = quality
+	}
+
+	for _, encoding := range supported {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality = wildcardQuality
+		}
+
+		if quality > selectedQuality {
+			selected = encoding
+			selectedQuality = quality
+		}
+	}
+
+	return selected
+}
+
+// NewReader returns reader decoding body compressed with given Content-Encoding. Memory used by zstd decoder
+// is bounded by maxSize of decoded body, the reader returns BodyTooLarge for frames whose window exceeds it.
+// Zero maxSize means the body is not limited. Size of decoded body has to be limited by the caller.
+func NewReader(contentEncoding string, body io.Reader, maxSize int64) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "", Identity:
+		return io.NopCloser(body), nil
+	case Gzip:
+		reader, err := gzip.NewReader(body)
+		return reader, jErrors.Trace(err)
+	case Deflate:
+		reader, err := zlib.NewReader(body)
+		return reader, jErrors.Trace(err)
+	case Zstd:
+		return newZstdReader(body, maxSize)
+	default:
+		return nil, jErrors.Trace(UnsupportedEncoding)
+	}
+}
+
+// zstdReader reports frames exceeding window or size limits as BodyTooLarge.
+type zstdReader struct {
+	io.ReadCloser
+}
+
+func newZstdReader(body io.Reader, maxSize int64) (io.ReadCloser, error) {
+	maxWindow := uint64(zstdMaxWindow)
+	opts := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+	if maxSize > 0 {
+		maxWindow = max(uint64(maxSize), zstd.MinWindowSize)
+		opts = append(opts, zstd.WithDecoderMaxMemory(uint64(maxSize)+1))
+	}
+	opts = append(opts, zstd.WithDecoderMaxWindow(maxWindow))
+
+	decoder, err := zstd.NewReader(body, opts...)
+	if err != nil {
+		return nil, jErrors.Trace(err)
+	}
+	return zstdReader{decoder.IOReadCloser()}, nil
+}
+
+func (r zstdReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if errors.Is(err, zstd.ErrWindowSizeExceeded) || errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+		return n, jErrors.Annotate(BodyTooLarge, err.Error())
+	}
+	return n, err //nolint:wrapcheck
+}
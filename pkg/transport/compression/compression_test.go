@@ -0,0 +1,129 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package compression_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/eset/grpc-rest-proxy/pkg/transport/compression"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	supported := []string{compression.Gzip, compression.Zstd, compression.Deflate}
+
+	tests := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{acceptEncoding: "", expected: ""},
+		{acceptEncoding: "identity", expected: ""},
+		{acceptEncoding: "br", expected: ""},
+		{acceptEncoding: "deflate, gzip", expected: compression.Gzip},
+		{acceptEncoding: "gzip;q=0.5, zstd", expected: compression.Zstd},
+		{acceptEncoding: "gzip;q=0, deflate;q=0.1", expected: compression.Deflate},
+		{acceptEncoding: "*", expected: compression.Gzip},
+		{acceptEncoding: "*;q=0.5, gzip;q=0.1", expected: compression.Zstd},
+		{acceptEncoding: "ZSTD", expected: compression.Zstd},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, compression.Negotiate(test.acceptEncoding, supported), test.acceptEncoding)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	compressor, err := compression.New(&compression.Config{
+		MinSize:      10,
+		Encodings:    []string{compression.Gzip, compression.Zstd, compression.Deflate},
+		ContentTypes: []string{"application/json"},
+	})
+	require.NoError(t, err)
+
+	body := []byte(strings.Repeat(`{"name":"John"}`, 100))
+
+	for _, encoding := range []string{compression.Gzip, compression.Zstd, compression.Deflate} {
+		header := http.Header{"Content-Type": []string{"application/json; charset=utf-8"}}
+		compressed, err := compressor.Compress(header, encoding, body)
+		require.NoError(t, err)
+		require.Equal(t, encoding, header.Get("Content-Encoding"))
+		require.Less(t, len(compressed), len(body))
+
+		reader, err := compression.NewReader(encoding, bytes.NewReader(compressed), 0)
+		require.NoError(t, err)
+		decompressed, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		require.Equal(t, body, decompressed)
+	}
+
+	header := http.Header{"Content-Type": []string{"application/json"}}
+	small, err := compressor.Compress(header, compression.Gzip, []byte("{}"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("{}"), small)
+	require.Empty(t, header.Get("Content-Encoding"), "body under minimal size")
+
+	header = http.Header{"Content-Type": []string{"image/png"}}
+	_, err = compressor.Compress(header, compression.Gzip, body)
+	require.NoError(t, err)
+	require.Empty(t, header.Get("Content-Encoding"), "content type is not compressible")
+
+	_, err = compression.NewReader("br", bytes.NewReader(body), 0)
+	require.ErrorIs(t, err, compression.UnsupportedEncoding)
+}
+
+func TestZstdReaderLimits(t *testing.T) {
+	encode := func(windowSize int, body []byte) []byte {
+		var buf bytes.Buffer
+		writer, err := zstd.NewWriter(&buf, zstd.WithWindowSize(windowSize))
+		require.NoError(t, err)
+		_, err = writer.Write(body)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+		return buf.Bytes()
+	}
+	read := func(compressed []byte, maxSize int64) ([]byte, error) {
+		reader, err := compression.NewReader(compression.Zstd, bytes.NewReader(compressed), maxSize)
+		require.NoError(t, err)
+		defer reader.Close()
+		return io.ReadAll(reader)
+	}
+
+	// frame declaring 512 MiB window with single raw block containing {}
+	hugeWindow := []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 0x98, 0x11, 0x00, 0x00, '{', '}'}
+	body := make([]byte, 100*1024)
+
+	decoded, err := read(encode(1<<15, body), int64(len(body)))
+	require.NoError(t, err)
+	require.Equal(t, body, decoded)
+
+	_, err = read(hugeWindow, 64*1024)
+	require.ErrorIs(t, err, compression.BodyTooLarge, "window larger than body limit")
+
+	_, err = read(hugeWindow, 0)
+	require.ErrorIs(t, err, compression.BodyTooLarge, "window is limited when body is not")
+}
+
+func TestCompressETag(t *testing.T) {
+	compressor, err := compression.New(&compression.Config{Encodings: []string{compression.Gzip}})
+	require.NoError(t, err)
+
+	body := []byte(strings.Repeat(`{"name":"John"}`, 100))
+
+	header := http.Header{"Etag": []string{`"abc"`}}
+	_, err = compressor.Compress(header, compression.Gzip, body)
+	require.NoError(t, err)
+	require.Equal(t, `W/"abc"`, header.Get("ETag"), "compressed representation has weak entity tag")
+
+	header = http.Header{"Etag": []string{`"abc"`}}
+	_, err = compressor.Compress(header, "identity", body)
+	require.NoError(t, err)
+	require.Equal(t, `"abc"`, header.Get("ETag"))
+}
@@ -6,6 +6,8 @@ package transport
 import (
 	"time"
 
+	"github.com/eset/grpc-rest-proxy/pkg/service/transformer"
+	"github.com/eset/grpc-rest-proxy/pkg/transport/compression"
 	"github.com/eset/grpc-rest-proxy/pkg/transport/http"
 )
 
@@ -14,7 +16,37 @@ type Config struct {
 }
 
 type ConfigHTTP struct {
-	MaxRequestSizeKB uint               `mapstructure:"maxRequestSizeKB"`
-	RequestTimeout   time.Duration      `mapstructure:"requestTimeout" validate:"gte=0"`
-	Server           *http.ServerConfig `mapstructure:"server" validate:"required"`
+	MaxRequestSizeKB uint                `mapstructure:"maxRequestSizeKB"`
+	RequestTimeout   time.Duration       `mapstructure:"requestTimeout" validate:"gte=0"`
+	Server           *http.ServerConfig  `mapstructure:"server" validate:"required"`
+	Compression      *compression.Config `mapstructure:"compression"`
+	RPC              *RPCConfig          `mapstructure:"rpc"`
+	QueryParams      QueryParamsPolicy   `mapstructure:"queryParams" validate:"omitempty,oneof=strict lenient"`
+	// names of fields accepted in query parameters and forms, both proto and JSON names when empty
+	FieldNaming transformer.FieldNaming `mapstructure:"fieldNaming" validate:"omitempty,oneof=both proto json"`
+	// hides details of invalid requests which may reveal internals of the service, e.g. in production
+	HideErrorDetails bool `mapstructure:"hideErrorDetails"`
+	// format of error responses: status, grpcGateway, problem or name of registered custom formatter
+	ErrorFormat string             `mapstructure:"errorFormat"`
+	StatusCodes *StatusCodesConfig `mapstructure:"statusCodes"`
+	// sends google.protobuf.Empty responses as 204 No Content without body
+	EmptyAsNoContent bool `mapstructure:"emptyAsNoContent"`
+	// maximum size of a single part of multipart/form-data body, unlimited when zero
+	MaxPartSizeKB uint `mapstructure:"maxPartSizeKB"`
+	// normalization of paths not matching any route, e.g. trailing or duplicate slashes
+	PathNormalization *PathNormalizationConfig `mapstructure:"pathNormalization"`
+	// rewrites of paths applied before routes are matched, the first matching rewrite is used
+	Rewrites []*RewriteConfig `mapstructure:"rewrites" validate:"dive"`
+	// path of the health status endpoint, disabled when empty
+	StatusPath string `mapstructure:"statusPath"`
+	// route patterns or gRPC methods whose bytes parameters and form fields are taken as they are instead of base64
+	RawBytesRoutes []string `mapstructure:"rawBytesRoutes"`
+	// content types of responses in order of preference, JSON is used when empty
+	ContentTypes []string `mapstructure:"contentTypes" validate:"dive,oneof=application/json application/x-protobuf application/x-ndjson"`
+}
+
+// RPCConfig enables RPC protocols served next to REST routes for all methods of loaded services.
+type RPCConfig struct {
+	GRPCWeb bool `mapstructure:"grpcWeb"`
+	Connect bool `mapstructure:"connect"`
 }
@@ -0,0 +1,184 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+package transport
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/eset/grpc-rest-proxy/pkg/service/transformer"
+	"github.com/eset/grpc-rest-proxy/pkg/transport/compression"
+
+	jErrors "github.com/juju/errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	grpcStatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	connectTrailerPrefix = "Trailer-"
+	flagConnectEndStream = 0x02
+)
+
+// connectError is JSON representation of error defined by Connect protocol.
+type connectError struct {
+	Code    string               `json:"code"`
+	Message string               `json:"message,omitempty"`
+	Details []connectErrorDetail `json:"details,omitempty"`
+}
+
+type connectErrorDetail struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type connectEndStream struct {
+	Error    *connectError       `json:"error,omitempty"`
+	Metadata map[string][]string `json:"metadata,omitempty"`
+}
+
+// serveConnectUnary proxies Connect unary request sent by POST or GET.
+func (e *ProxyEndpoint) serveConnectUnary(w http.ResponseWriter, call *rpcCall) {
+	r := call.httpRequest
+	resp := &response{code: http.StatusOK, header: make(http.Header)}
+
+	var header, trailer metadata.MD
+	request, err := e.readConnectUnaryRequest(call)
+	if err == nil && call.spec.ServerStreaming {
+		err = grpcStatus.Error(codes.Unimplemented, "streaming methods require Connect streaming protocol")
+	}
+	if err == nil {
+		trailer, err = e.invokeRPC(call, request, func(md metadata.MD) { header = md }, func(m proto.Message) error {
+			data, err := e.marshalRPCMessage(call, m)
+			resp.body = data
+			return jErrors.Trace(err)
+		})
+	}
+
+	transformer.SetRESTHeaders(r.ProtoMajor, resp.header, filterMetadata(header), call.contentType)
+	for key, values := range filterMetadata(trailer) {
+		for _, value := range values {
+			resp.header.Add(connectTrailerPrefix+key, value)
+		}
+	}
+
+	if err != nil {
+		st := e.getRPCStatus(r, err)
+		resp.code = transformer.GetHTTPStatusCode(st.Code())
+		resp.header.Set(headerContentType, ContentTypeJSON)
+		resp.body, err = json.Marshal(newConnectError(st))
+		if err != nil {
+			e.logger.ErrorContext(r.Context(), jErrors.Details(jErrors.Trace(err)))
+		}
+	}
+
+	e.writeResponse(w, r, resp)
+}
+
+func (e *ProxyEndpoint) readConnectUnaryRequest(call *rpcCall) (*dynamicpb.Message, error) {
+	r := call.httpRequest
+	if r.Method != http.MethodGet {
+		body, err := readRequestBody(r, e.maxRequestSize)
+		if err != nil {
+			return nil, jErrors.Trace(err)
+		}
+		return e.unmarshalRPCMessage(call, body)
+	}
+
+	query := r.URL.Query()
+	if encoding := query.Get("compression"); encoding != "" && encoding != compression.Identity {
+		return nil, jErrors.Annotatef(compression.UnsupportedEncoding, "%s", encoding)
+	}
+
+	message := []byte(query.Get("message"))
+	if query.Get("base64") == "1" {
+		var err error
+		message, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(string(message), "="))
+		if err != nil {
+			return nil, jErrors.Trace(err)
+		}
+	}
+	return e.unmarshalRPCMessage(call, message)
+}
+
+// serveConnectStream proxies Connect streaming request. The response ends with end-stream message
+// carrying status and trailer metadata.
+func (e *ProxyEndpoint) serveConnectStream(w http.ResponseWriter, call *rpcCall) {
+	r := call.httpRequest
+	rc := http.NewResponseController(w)
+
+	headerWritten := false
+	writeHeader := func(header metadata.MD) {
+		transformer.SetRESTHeaders(r.ProtoMajor, w.Header(), filterMetadata(header), call.contentType)
+		w.WriteHeader(http.StatusOK)
+		headerWritten = true
+	}
+
+	var trailer metadata.MD
+	request, err := e.readRPCRequest(call)
+	if err == nil {
+		trailer, err = e.invokeRPC(call, request, writeHeader, func(m proto.Message) error {
+			data, err := e.marshalRPCMessage(call, m)
+			if err != nil {
+				return jErrors.Trace(err)
+			}
+			if _, err = w.Write(encodeEnvelope(0, data)); err != nil {
+				return jErrors.Trace(err)
+			}
+			return jErrors.Trace(rc.Flush())
+		})
+	}
+
+	if !headerWritten {
+		writeHeader(nil)
+	}
+
+	endStream := connectEndStream{Metadata: filterMetadata(trailer)}
+	if err != nil {
+		endStream.Error = newConnectError(e.getRPCStatus(r, err))
+	}
+
+	data, err := json.Marshal(endStream)
+	if err == nil {
+		_, err = w.Write(encodeEnvelope(flagConnectEndStream, data))
+	}
+	if err != nil {
+		e.logger.ErrorContext(r.Context(), jErrors.Details(jErrors.Trace(err)))
+	}
+}
+
+func newConnectError(st *grpcStatus.Status) *connectError {
+	connectErr := &connectError{
+		Code:    getConnectCode(st.Code()),
+		Message: st.Message(),
+	}
+	for _, detail := range st.Proto().GetDetails() {
+		connectErr.Details = append(connectErr.Details, connectErrorDetail{
+			Type:  detail.GetTypeUrl()[strings.LastIndex(detail.GetTypeUrl(), "/")+1:],
+			Value: base64.RawStdEncoding.EncodeToString(detail.GetValue()),
+		})
+	}
+	return connectErr
+}
+
+// getConnectCode returns name of the code used by Connect protocol, e.g. invalid_argument.
+func getConnectCode(code codes.Code) string {
+	if code == codes.OK || code > codes.Unauthenticated {
+		return "unknown"
+	}
+
+	var sb strings.Builder
+	for i, c := range code.String() {
+		if unicode.IsUpper(c) && i > 0 {
+			sb.WriteByte('_')
+		}
+		sb.WriteRune(unicode.ToLower(c))
+	}
+	return sb.String()
+}
@@ -4,145 +4,518 @@ package transport
 
 import (
 	"context"
+	"errors"
 	"io"
 	"net/http"
-	"net/url"
+	"slices"
 	"strings"
 
 	grpcClient "github.com/eset/grpc-rest-proxy/pkg/gateway/grpc"
+	"github.com/eset/grpc-rest-proxy/pkg/service/cache"
+	"github.com/eset/grpc-rest-proxy/pkg/service/coalescer"
 	"github.com/eset/grpc-rest-proxy/pkg/service/jsonencoder"
 	routerPkg "github.com/eset/grpc-rest-proxy/pkg/service/router"
 	"github.com/eset/grpc-rest-proxy/pkg/service/transformer"
-	statusPkg "github.com/eset/grpc-rest-proxy/pkg/transport/status"
+	"github.com/eset/grpc-rest-proxy/pkg/transport/compression"
 
 	jErrors "github.com/juju/errors"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	grpcStatus "google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/dynamicpb"
 )
 
+const (
+	RequestTooLarge = jErrors.ConstError("request body is too large")
+
+	headerETag            = "ETag"
+	headerIfNoneMatch     = "If-None-Match"
+	headerAcceptEncoding  = "Accept-Encoding"
+	headerContentEncoding = "Content-Encoding"
+	headerContentType     = "Content-Type"
+	headerAccept          = "Accept"
+	headerVary            = "Vary"
+	headerTE              = "TE"
+	headerTrailer         = "Trailer"
+	headerLocation        = "Location"
+
+	emptyName = "google.protobuf.Empty"
+)
+
 type ProxyEndpoint struct {
-	logger      Logger
-	router      *routerPkg.Router
-	client      grpcClient.ClientInterface
-	jsonEncoder jsonencoder.Encoder
+	logger         Logger
+	maxRequestSize int64
+	router         *routerPkg.Router
+	queryParams    QueryParamsPolicy
+	fieldNaming    transformer.FieldNaming
+	hideDetails    bool
+	requestOptions *transformer.RequestOptions
+	rawBytesRoutes []string
+	methods        map[string]*routerPkg.GrpcSpec
+	rpcConf        *RPCConfig
+	client         grpcClient.ClientInterface
+	jsonEncoder    responseEncoder
+	encoders       []responseEncoder
+	cache          *cache.Cache
+	coalescer      *coalescer.Group[*response]
+	compressor     *compression.Compressor
+	errorFormatter ErrorFormatter
+	statusCodes    *statusCodes
+	pathNormalizer *pathNormalizer
+	pathRewriter   pathRewriter
+	// google.protobuf.Empty responses are sent as 204 No Content
+	emptyAsNoContent bool
+}
+
+// proxyRequest holds state of a single request which is being proxied.
+type proxyRequest struct {
+	httpRequest *http.Request
+	routeMatch  *routerPkg.Match
+	rpcRequest  *dynamicpb.Message
+	encoder     responseEncoder
+}
+
+// variant identifies the gRPC method together with the representation of its response.
+func (req *proxyRequest) variant() string {
+	return req.routeMatch.GrpcSpec.FullPath() + " " + req.encoder.ContentType()
+}
+
+// response is encoded upstream response which is not yet written to the client.
+type response struct {
+	code   int
+	header http.Header
+	// trailer is sent as HTTP trailers when the client accepts them, otherwise it is merged into header
+	trailer http.Header
+	body    []byte
 }
 
+// mergedHeader returns copy of the header with trailers added.
+func (resp *response) mergedHeader() http.Header {
+	header := resp.header.Clone()
+	for name, values := range resp.trailer {
+		header[name] = append(header[name], values...)
+	}
+	return header
+}
+
+// NewProxyEndpoint creates endpoint proxying REST requests to gRPC.
+// Methods are addressed by their gRPC path when gRPC-Web or Connect protocol is enabled.
+// Response cache and request coalescing are optional and disabled when their config is nil.
 func NewProxyEndpoint(
 	logger Logger,
+	conf *ConfigHTTP,
 	router *routerPkg.Router,
+	methods map[string]*routerPkg.GrpcSpec,
 	client grpcClient.ClientInterface,
 	jsonEncoder jsonencoder.Encoder,
-) *ProxyEndpoint {
-	return &ProxyEndpoint{
-		logger:      logger,
-		router:      router,
-		client:      client,
-		jsonEncoder: jsonEncoder,
+	cacheConf *cache.Config,
+	coalescerConf *coalescer.Config,
+) (*ProxyEndpoint, error) {
+	endpoint := &ProxyEndpoint{
+		logger:         logger,
+		maxRequestSize: int64(conf.MaxRequestSizeKB) * 1024, //nolint:mnd
+		router:         router,
+		queryParams:    conf.QueryParams,
+		fieldNaming:    conf.FieldNaming,
+		hideDetails:    conf.HideErrorDetails,
+		requestOptions: &transformer.RequestOptions{
+			FieldNaming:         conf.FieldNaming,
+			IgnoreUnknownFields: conf.QueryParams == QueryParamsLenient,
+			MaxPartSize:         int64(conf.MaxPartSizeKB) * 1024, //nolint:mnd
+		},
+		rawBytesRoutes:   conf.RawBytesRoutes,
+		emptyAsNoContent: conf.EmptyAsNoContent,
+		methods:          methods,
+		client:           client,
+		jsonEncoder:      jsonResponseEncoder{jsonEncoder},
 	}
+	endpoint.encoders = newResponseEncoders(conf.ContentTypes, jsonEncoder)
+	endpoint.pathNormalizer = newPathNormalizer(conf.PathNormalization)
+
+	errorFormatter, err := getErrorFormatter(conf.ErrorFormat)
+	if err != nil {
+		return nil, jErrors.Trace(err)
+	}
+	endpoint.errorFormatter = errorFormatter
+
+	endpoint.pathRewriter, err = newPathRewriter(conf.Rewrites)
+	if err != nil {
+		return nil, jErrors.Trace(err)
+	}
+
+	endpoint.statusCodes, err = newStatusCodes(conf.StatusCodes)
+	if err != nil {
+		return nil, jErrors.Trace(err)
+	}
+
+	if conf.RPC != nil && (conf.RPC.GRPCWeb || conf.RPC.Connect) {
+		endpoint.rpcConf = conf.RPC
+	}
+
+	// cache is created together with the endpoint, so reloading descriptors invalidates all cached responses
+	if cacheConf != nil && cacheConf.Enabled {
+		endpoint.cache = cache.New(cacheConf)
+	}
+	if coalescerConf != nil && coalescerConf.Enabled {
+		endpoint.coalescer = coalescer.New[*response](coalescerConf)
+	}
+	if conf.Compression != nil && conf.Compression.Enabled {
+		compressor, err := compression.New(conf.Compression)
+		if err != nil {
+			return nil, jErrors.Trace(err)
+		}
+		endpoint.compressor = compressor
+	}
+
+	return endpoint, nil
 }
 
 func (e *ProxyEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if call, ok := e.matchRPC(r); ok {
+		e.serveRPC(w, call)
+		return
+	}
+
 	method, err := routerPkg.StringToMethod(r.Method)
 	if err != nil {
-		e.respondWithError(r.Context(), w, statusPkg.FromHTTPCode(http.StatusMethodNotAllowed))
+		e.respondWithError(w, r, newHTTPErrorStatus(http.StatusMethodNotAllowed))
 		return
 	}
 
-	routeMatch := e.router.Find(method, r.URL.Path)
+	path, rewritten := e.pathRewriter.rewriteRequestPath(r)
+	routeMatch, redirectPath := e.findRoute(method, path, !rewritten)
+	if redirectPath != "" {
+		e.redirect(w, r, redirectPath)
+		return
+	}
 	if routeMatch == nil {
-		e.respondWithError(r.Context(), w, statusPkg.FromHTTPCode(http.StatusNotFound))
+		e.respondWithError(w, r, newHTTPErrorStatus(http.StatusNotFound))
 		return
 	}
 
-	rpcRequest, err := convertRequestToGRPC(routeMatch, r)
+	encoder, ok := e.negotiateEncoder(r.Header.Get(headerAccept))
+	if !ok {
+		// google.api.HttpBody responses are written as they are, so the encoder is used for errors only
+		if !transformer.IsHTTPBody(routeMatch.GrpcSpec.ResponseDesc) {
+			e.respondWithError(w, r, newHTTPErrorStatus(http.StatusNotAcceptable))
+			return
+		}
+		encoder = e.jsonEncoder
+	}
+
+	rpcRequest, err := e.convertRequestToGRPC(routeMatch, r)
 	if err != nil {
 		e.logger.ErrorContext(r.Context(), jErrors.Details(jErrors.Trace(err)))
-		e.respondWithError(r.Context(), w, statusPkg.FromHTTPCode(http.StatusBadRequest))
+		e.respondWithError(w, r, e.getRequestErrorStatus(err))
+		return
+	}
+
+	req := &proxyRequest{
+		httpRequest: r,
+		routeMatch:  routeMatch,
+		rpcRequest:  rpcRequest,
+		encoder:     encoder,
+	}
+
+	if method != routerPkg.GET {
+		e.writeResponse(w, r, e.invoke(req))
 		return
 	}
-	rpcResponse := transformer.GetRPCResponse(routeMatch.GrpcSpec.ResponseDesc)
+
+	if e.cache != nil && e.cache.IsCacheable(routeMatch.Pattern, routeMatch.GrpcSpec.FullPath()) {
+		e.serveCached(w, req)
+		return
+	}
+
+	e.writeResponse(w, r, e.invokeCoalesced(req))
+}
+
+func (e *ProxyEndpoint) serveCached(w http.ResponseWriter, req *proxyRequest) {
+	r := req.httpRequest
+	key, err := e.cache.Key(req.variant(), req.rpcRequest, r.Header)
+	if err != nil {
+		e.logger.ErrorContext(r.Context(), jErrors.Details(jErrors.Trace(err)))
+		e.writeResponse(w, r, e.invokeCoalesced(req))
+		return
+	}
+
+	entry, ok := e.cache.Get(key)
+	if !ok {
+		resp := e.invokeCoalesced(req)
+		if resp.code != http.StatusOK {
+			e.writeResponse(w, r, resp)
+			return
+		}
+
+		// trailers of cached responses are sent as headers
+		entry = cache.NewEntry(resp.mergedHeader(), resp.body)
+		if ttl, cacheable := e.cache.TTL(entry.Header); cacheable {
+			e.cache.Set(key, entry, ttl)
+		}
+	}
+
+	resp := &response{code: http.StatusOK, header: entry.Header.Clone(), body: entry.Body}
+	resp.header.Set(headerETag, entry.ETag)
+
+	if cache.MatchETag(r.Header.Get(headerIfNoneMatch), entry.ETag) {
+		resp.code = http.StatusNotModified
+		resp.body = nil
+	}
+
+	e.writeResponse(w, r, resp)
+}
+
+// invokeCoalesced shares single upstream call among identical concurrent requests of eligible routes.
+func (e *ProxyEndpoint) invokeCoalesced(req *proxyRequest) *response {
+	r := req.httpRequest
+	if e.coalescer == nil || !e.coalescer.IsEligible(req.routeMatch.Pattern, req.routeMatch.GrpcSpec.FullPath()) {
+		return e.invoke(req)
+	}
+
+	key, err := transformer.GetRequestKey(req.variant(), req.rpcRequest, r.Header, e.coalescer.Headers())
+	if err != nil {
+		e.logger.ErrorContext(r.Context(), jErrors.Details(jErrors.Trace(err)))
+		return e.invoke(req)
+	}
+
+	resp, _, err := e.coalescer.Do(key, func() *response {
+		// upstream call must not be canceled when the client which started it goes away
+		sharedReq := *req
+		sharedReq.httpRequest = r.WithContext(context.WithoutCancel(r.Context()))
+		return e.invoke(&sharedReq)
+	})
+	if err != nil {
+		e.logger.ErrorContext(r.Context(), jErrors.Details(jErrors.Trace(err)))
+		return e.errorResponse(r, make(http.Header), newHTTPErrorStatus(http.StatusInternalServerError), e.errorEncoder(req.encoder))
+	}
+
+	// response is shared with other requests, so its header must not be modified
+	return &response{code: resp.code, header: resp.header.Clone(), trailer: resp.trailer.Clone(), body: resp.body}
+}
+
+func (e *ProxyEndpoint) invoke(req *proxyRequest) *response {
+	r := req.httpRequest
+	rpcResponse := transformer.GetRPCResponse(req.routeMatch.GrpcSpec.ResponseDesc)
+	resp := &response{code: http.StatusOK, header: http.Header{headerVary: []string{headerAccept}}}
 
 	var header, trailer metadata.MD
-	err = e.client.Invoke(
+	err := e.client.Invoke(
 		transformer.GetRPCRequestContext(r),
-		routeMatch.GrpcSpec.FullPath(),
-		rpcRequest,
+		req.routeMatch.GrpcSpec.FullPath(),
+		req.rpcRequest,
 		rpcResponse,
 		grpc.Header(&header),
 		grpc.Trailer(&trailer),
 	)
+	meta := popResponseMetadata(header, trailer)
 	if err != nil {
+		errorEncoder := e.errorEncoder(req.encoder)
 		if errStatus, ok := grpcStatus.FromError(err); ok {
-			transformer.SetRESTHeaders(r.ProtoMajor, w.Header(), header, trailer)
-			e.respondWithError(r.Context(), w, statusPkg.FromGRPC(errStatus))
-			return
+			transformer.SetRESTHeaders(r.ProtoMajor, resp.header, header, errorEncoder.ContentType())
+			resp.trailer = transformer.GetRESTTrailers(r.ProtoMajor, trailer)
+			status := newGRPCErrorStatus(errStatus, e.statusCodes.httpCode(req.routeMatch, errStatus.Code()))
+			status.HTTPCode = meta.apply(resp.header, status.HTTPCode)
+			return e.errorResponse(r, resp.header, status, errorEncoder)
 		}
 		e.logger.ErrorContext(r.Context(), jErrors.Details(jErrors.Trace(err)))
-		e.respondWithError(r.Context(), w, statusPkg.FromHTTPCode(http.StatusInternalServerError))
-		return
+		return e.errorResponse(r, resp.header, newHTTPErrorStatus(http.StatusInternalServerError), errorEncoder)
 	}
 
-	transformer.SetRESTHeaders(r.ProtoMajor, w.Header(), header, trailer)
+	transformer.SetRESTHeaders(r.ProtoMajor, resp.header, header, req.encoder.ContentType())
+	resp.trailer = transformer.GetRESTTrailers(r.ProtoMajor, trailer)
+
+	resp.code = e.statusCodes.httpCode(req.routeMatch, codes.OK)
+	if e.emptyAsNoContent && resp.code == http.StatusOK && rpcResponse.Descriptor().FullName() == emptyName {
+		resp.code = http.StatusNoContent
+	}
+	resp.code = meta.apply(resp.header, resp.code)
+	if resp.code == http.StatusNoContent {
+		resp.header.Del(headerContentType)
+		return resp
+	}
+
+	if transformer.IsHTTPBody(rpcResponse.Descriptor()) {
+		var contentType string
+		contentType, resp.body = transformer.GetHTTPBody(rpcResponse)
+		resp.header.Set(headerContentType, contentType)
+		return resp
+	}
 
-	response, err := e.jsonEncoder.Encode(rpcResponse)
+	resp.body, err = req.encoder.Encode(rpcResponse)
 	if err != nil {
 		e.logger.ErrorContext(r.Context(), jErrors.Details(jErrors.Trace(err)))
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return &response{code: http.StatusInternalServerError, header: resp.header}
 	}
 
-	_, err = w.Write(response)
+	return resp
+}
+
+func (e *ProxyEndpoint) errorResponse(r *http.Request, header http.Header, status *ErrorStatus, encoder responseEncoder) *response {
+	body, contentType, err := e.errorFormatter.Format(r, status, encoder, e.jsonEncoder)
 	if err != nil {
 		e.logger.ErrorContext(r.Context(), jErrors.Details(jErrors.Trace(err)))
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return &response{code: http.StatusInternalServerError, header: header}
 	}
+
+	header.Set(headerContentType, contentType)
+	return &response{code: status.HTTPCode, header: header, body: body}
 }
 
-func (e *ProxyEndpoint) respondWithError(ctx context.Context, w http.ResponseWriter, status *statusPkg.Error) {
-	encodedStatus, err := e.jsonEncoder.Encode(status)
-	if err != nil {
-		e.logger.ErrorContext(ctx, jErrors.Details(jErrors.Trace(err)))
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+func (e *ProxyEndpoint) respondWithError(w http.ResponseWriter, r *http.Request, status *ErrorStatus) {
+	e.writeResponse(w, r, e.errorResponse(r, make(http.Header), status, e.jsonEncoder))
+}
+
+func (e *ProxyEndpoint) writeResponse(w http.ResponseWriter, r *http.Request, resp *response) {
+	body := resp.body
+	header := resp.header
+	bodyAllowed := resp.code != http.StatusNoContent && resp.code != http.StatusNotModified
+	useTrailers := len(resp.trailer) > 0 && bodyAllowed && acceptsTrailers(r)
+	if !useTrailers && len(resp.trailer) > 0 {
+		header = resp.mergedHeader()
+	}
+	for name, values := range header {
+		w.Header()[name] = values
+	}
+	if useTrailers {
+		// declared trailers make HTTP/1.1 response chunked
+		for name := range resp.trailer {
+			w.Header().Add(headerTrailer, name)
+		}
 	}
 
-	w.WriteHeader(int(status.GetCode()))
+	if e.compressor != nil && resp.code != http.StatusNotModified {
+		var err error
+		body, err = e.compressor.Compress(w.Header(), r.Header.Get(headerAcceptEncoding), resp.body)
+		if err != nil {
+			e.logger.ErrorContext(r.Context(), jErrors.Details(jErrors.Trace(err)))
+			body = resp.body
+		}
+	}
+	w.WriteHeader(resp.code)
 
-	_, err = w.Write(encodedStatus)
-	if err != nil {
-		e.logger.ErrorContext(ctx, jErrors.Details(jErrors.Trace(err)))
+	if len(body) > 0 && bodyAllowed {
+		if _, err := w.Write(body); err != nil {
+			e.logger.ErrorContext(r.Context(), jErrors.Details(jErrors.Trace(err)))
+		}
+	}
+
+	if useTrailers {
+		for name, values := range resp.trailer {
+			w.Header()[name] = values
+		}
 	}
 }
 
-func getQueryVariables(queryValues url.Values) []transformer.Variable {
-	var queryVariables []transformer.Variable
-	for name, values := range queryValues {
-		fieldPath := strings.Split(name, ".")
-		for _, value := range values {
-			queryVariables = append(queryVariables, transformer.Variable{FieldPath: fieldPath, Value: value})
+// acceptsTrailers reports whether the client announced support of trailers by TE header. HTTP/1.0 responses
+// cannot carry trailers as they are not chunked.
+func acceptsTrailers(r *http.Request) bool {
+	if !r.ProtoAtLeast(1, 1) {
+		return false
+	}
+	for _, value := range r.Header.Values(headerTE) {
+		for _, token := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(token, ";")
+			if strings.EqualFold(strings.TrimSpace(name), "trailers") {
+				return true
+			}
 		}
 	}
-	return queryVariables
+	return false
 }
 
-func convertRequestToGRPC(route *routerPkg.Match, r *http.Request) (req *dynamicpb.Message, err error) {
-	reqBody, err := io.ReadAll(r.Body)
+// findRoute matches the path as it is first, canonical path is matched only when no route matches. Path to redirect
+// to is returned instead of the route when normalization of the path is configured to redirect and redirect is
+// allowed, rewritten paths are not known to the client, so they are never redirected.
+func (e *ProxyEndpoint) findRoute(method routerPkg.MethodType, path string, allowRedirect bool) (*routerPkg.Match, string) {
+	if routeMatch := e.router.Find(method, path); routeMatch != nil {
+		return routeMatch, ""
+	}
+
+	normalized, redirect := e.pathNormalizer.normalize(path)
+	if normalized == path {
+		return nil, ""
+	}
+
+	routeMatch := e.router.Find(method, normalized)
+	if routeMatch != nil && redirect && allowRedirect && isLocalPath(normalized) {
+		return nil, normalized
+	}
+	return routeMatch, ""
+}
+
+// isLocalPath reports whether the path used as Location stays on this host. Paths starting by two slashes,
+// or by slash and backslash which browsers treat the same way, are protocol-relative URLs of another host.
+func isLocalPath(path string) bool {
+	return !strings.HasPrefix(path, "//") && !strings.HasPrefix(path, "/\\")
+}
+
+// redirect answers with 308 Permanent Redirect, which keeps the method and body of the request.
+func (e *ProxyEndpoint) redirect(w http.ResponseWriter, r *http.Request, path string) {
+	location := path
+	if r.URL.RawQuery != "" {
+		location += "?" + r.URL.RawQuery
+	}
+	w.Header().Set(headerLocation, location)
+	w.WriteHeader(http.StatusPermanentRedirect)
+}
+
+func (e *ProxyEndpoint) convertRequestToGRPC(route *routerPkg.Match, r *http.Request) (req *dynamicpb.Message, err error) {
+	reqBody, err := readRequestBody(r, e.maxRequestSize)
 	if err != nil {
 		return nil, jErrors.Trace(err)
 	}
-	r.Body.Close()
 
-	queryVariables := getQueryVariables(r.URL.Query())
+	queryVariables, err := e.getQueryVariables(route, r.URL.Query(), len(reqBody) > 0)
+	if err != nil {
+		return nil, jErrors.Trace(err)
+	}
 	route.Params = append(route.Params, queryVariables...)
 
-	req, err = transformer.GetRPCRequest(reqBody, route.GrpcSpec.RequestDesc, route.Params, route.BodyRule)
+	req, err = transformer.GetRPCRequestWithOptions(
+		reqBody,
+		route.GrpcSpec.RequestDesc,
+		route.Params,
+		route.BodyRule,
+		e.getRequestOptions(route, r.Header.Get(headerContentType)),
+	)
 	if err != nil {
 		return nil, jErrors.Trace(err)
 	}
 
 	return req, nil
 }
+
+// getRequestOptions returns options of the request, bytes are taken raw for routes listed in rawBytesRoutes.
+func (e *ProxyEndpoint) getRequestOptions(route *routerPkg.Match, contentType string) *transformer.RequestOptions {
+	opts := *e.requestOptions
+	opts.ContentType = contentType
+	opts.RawBytes = slices.Contains(e.rawBytesRoutes, route.Pattern) || slices.Contains(e.rawBytesRoutes, route.GrpcSpec.FullPath())
+	return &opts
+}
+
+// readRequestBody reads request body decoded according to Content-Encoding. Size limit applies to decoded body.
+func readRequestBody(r *http.Request, maxSize int64) ([]byte, error) {
+	defer r.Body.Close()
+
+	reader, err := compression.NewReader(r.Header.Get(headerContentEncoding), r.Body, maxSize)
+	if err != nil {
+		return nil, jErrors.Trace(err)
+	}
+	defer reader.Close()
+
+	var limited io.Reader = reader
+	if maxSize > 0 {
+		limited = io.LimitReader(reader, maxSize+1)
+	}
+
+	body, err := io.ReadAll(limited)
+	if errors.Is(err, compression.BodyTooLarge) || (maxSize > 0 && int64(len(body)) > maxSize) {
+		return nil, jErrors.Trace(RequestTooLarge)
+	}
+	if err != nil {
+		return nil, jErrors.Trace(err)
+	}
+	return body, nil
+}
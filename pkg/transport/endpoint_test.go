@@ -0,0 +1,141 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package transport
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/eset/grpc-rest-proxy/pkg/service/coalescer"
+	"github.com/eset/grpc-rest-proxy/pkg/service/jsonencoder"
+	routerPkg "github.com/eset/grpc-rest-proxy/pkg/service/router"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func newTrailerEndpoint(t *testing.T, header metadata.MD) *ProxyEndpoint {
+	t.Helper()
+
+	client := &testClient{handle: echo, header: header, trailer: metadata.Pairs("x-trace", "abc")}
+	route := routerPkg.NewRoute("/echo/{value}", "", routerPkg.GET, newTestSpec("Echo", false))
+	return newTestEndpoint(t, &ConfigHTTP{}, client, route)
+}
+
+func TestResponseTrailers(t *testing.T) {
+	server := httptest.NewServer(newTrailerEndpoint(t, nil))
+	defer server.Close()
+
+	get := func(te string) *http.Response {
+		r, err := http.NewRequest(http.MethodGet, server.URL+"/echo/John", nil)
+		require.NoError(t, err)
+		if te != "" {
+			r.Header.Set(headerTE, te)
+		}
+		resp, err := http.DefaultClient.Do(r)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.JSONEq(t, `"hello John"`, string(body))
+		return resp
+	}
+
+	resp := get("trailers")
+	require.Equal(t, "HTTP/1.1", resp.Proto)
+	require.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+	require.Empty(t, resp.Header.Get("X-Trace"))
+	require.Equal(t, "abc", resp.Trailer.Get("X-Trace"))
+
+	resp = get("gzip, trailers;q=1")
+	require.Equal(t, "abc", resp.Trailer.Get("X-Trace"), "trailers are accepted among other codings")
+
+	resp = get("")
+	require.Equal(t, "abc", resp.Header.Get("X-Trace"), "trailers are merged into header")
+	require.Empty(t, resp.Trailer)
+	require.Empty(t, resp.Header.Get(headerTrailer))
+}
+
+func TestResponseTrailersWithoutBody(t *testing.T) {
+	for _, code := range []int{http.StatusNoContent, http.StatusNotModified} {
+		endpoint := newTrailerEndpoint(t, metadata.Pairs(metadataHTTPCode, strconv.Itoa(code)))
+
+		r := httptest.NewRequest(http.MethodGet, "/echo/John", nil)
+		r.Header.Set(headerTE, "trailers")
+		w := httptest.NewRecorder()
+		endpoint.ServeHTTP(w, r)
+
+		resp := w.Result()
+		require.Equal(t, code, resp.StatusCode)
+		require.Empty(t, w.Body.Bytes())
+		require.Equal(t, "abc", resp.Header.Get("X-Trace"), "response without body carries trailers in header")
+		require.Empty(t, resp.Header.Get(headerTrailer))
+		require.Empty(t, resp.Trailer)
+	}
+}
+
+func TestAcceptsTrailers(t *testing.T) {
+	tests := []struct {
+		proto    string
+		te       []string
+		expected bool
+	}{
+		{"HTTP/1.1", []string{"trailers"}, true},
+		{"HTTP/1.1", []string{"deflate", "Trailers"}, true},
+		{"HTTP/2.0", []string{"trailers"}, true},
+		{"HTTP/1.1", []string{"gzip;q=0.5, trailers"}, true},
+		{"HTTP/1.1", []string{"gzip"}, false},
+		{"HTTP/1.1", nil, false},
+		{"HTTP/1.0", []string{"trailers"}, false},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Proto = test.proto
+		r.ProtoMajor, r.ProtoMinor, _ = http.ParseHTTPVersion(test.proto)
+		for _, te := range test.te {
+			r.Header.Add(headerTE, te)
+		}
+		require.Equal(t, test.expected, acceptsTrailers(r), "%s %v", test.proto, test.te)
+	}
+}
+
+func TestCoalescedFailure(t *testing.T) {
+	route := routerPkg.NewRoute("/echo/{value}", "", routerPkg.GET, newTestSpec("Echo", false))
+	router, err := routerPkg.NewRouterWithRoutes([]*routerPkg.Route{route})
+	require.NoError(t, err)
+
+	client := &testClient{handle: func(context.Context, *wrapperspb.StringValue) ([]proto.Message, error) {
+		panic("upstream call failed")
+	}}
+	conf := &ConfigHTTP{ContentTypes: []string{ContentTypeJSON, ContentTypeNDJSON}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	encoder := jsonencoder.New(&jsonencoder.Config{}, nil)
+	endpoint, err := NewProxyEndpoint(logger, conf, router, nil, client, encoder, nil,
+		&coalescer.Config{Enabled: true, Routes: []string{"/echo/{value}"}})
+	require.NoError(t, err)
+
+	w := serve(endpoint, http.MethodGet, "/echo/John", "", nil, http.Header{headerAccept: []string{ContentTypeNDJSON}})
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Equal(t, ContentTypeJSON, w.Header().Get(headerContentType), "errors of coalesced calls are encoded as JSON")
+	require.Contains(t, w.Body.String(), `"code":`)
+}
+
+func TestReadRequestBodyZstdWindow(t *testing.T) {
+	// frame declaring 512 MiB window with single raw block containing {}
+	frame := []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 0x98, 0x11, 0x00, 0x00, '{', '}'}
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(frame))
+	r.Header.Set(headerContentEncoding, "zstd")
+
+	_, err := readRequestBody(r, 1024)
+	require.ErrorIs(t, err, RequestTooLarge)
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+package transport
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/eset/grpc-rest-proxy/pkg/service/transformer"
+	statusPkg "github.com/eset/grpc-rest-proxy/pkg/transport/status"
+
+	jErrors "github.com/juju/errors"
+
+	rpcStatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	grpcStatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const (
+	// StatusErrorFormat is {code, message, details} with HTTP status code
+	StatusErrorFormat = "status"
+	// GRPCGatewayErrorFormat is {code, message, details} with gRPC code as returned by grpc-gateway
+	GRPCGatewayErrorFormat = "grpcGateway"
+	// ProblemErrorFormat is RFC 9457 problem details
+	ProblemErrorFormat = "problem"
+
+	ContentTypeProblemJSON = "application/problem+json"
+)
+
+// ErrorStatus is error reported to the REST client.
+type ErrorStatus struct {
+	HTTPCode int
+	Code     codes.Code
+	Message  string
+	Details  []*anypb.Any
+}
+
+// MessageEncoder encodes protobuf messages into representation of given content type.
+type MessageEncoder interface {
+	ContentType() string
+	Encode(m proto.Message) ([]byte, error)
+}
+
+// ErrorFormatter encodes body of error responses. Encoder is negotiated with the client, JSON or protobuf,
+// JSON encoder is provided for formats which are always JSON. Both encoders resolve types of loaded services.
+type ErrorFormatter interface {
+	Format(r *http.Request, status *ErrorStatus, encoder, jsonEncoder MessageEncoder) (body []byte, contentType string, err error)
+}
+
+var (
+	errorFormattersMu sync.RWMutex
+	errorFormatters   = map[string]ErrorFormatter{
+		StatusErrorFormat:      statusErrorFormatter{},
+		GRPCGatewayErrorFormat: grpcGatewayErrorFormatter{},
+		ProblemErrorFormat:     problemErrorFormatter{},
+	}
+)
+
+// RegisterErrorFormatter makes formatter selectable by its name in configuration. It is intended for
+// applications embedding the proxy and must be called before endpoints are created.
+func RegisterErrorFormatter(name string, formatter ErrorFormatter) {
+	errorFormattersMu.Lock()
+	defer errorFormattersMu.Unlock()
+	errorFormatters[name] = formatter
+}
+
+func getErrorFormatter(name string) (ErrorFormatter, error) {
+	if name == "" {
+		name = StatusErrorFormat
+	}
+
+	errorFormattersMu.RLock()
+	defer errorFormattersMu.RUnlock()
+	formatter, ok := errorFormatters[name]
+	if !ok {
+		return nil, jErrors.Errorf("unknown error format %s", name)
+	}
+	return formatter, nil
+}
+
+func newHTTPErrorStatus(httpCode int) *ErrorStatus {
+	return &ErrorStatus{
+		HTTPCode: httpCode,
+		Code:     transformer.GetGRPCCode(httpCode),
+		Message:  http.StatusText(httpCode),
+	}
+}
+
+func newGRPCErrorStatus(st *grpcStatus.Status, httpCode int) *ErrorStatus {
+	msg := st.Message()
+	if msg == "" {
+		msg = http.StatusText(httpCode)
+	}
+	return &ErrorStatus{
+		HTTPCode: httpCode,
+		Code:     st.Code(),
+		Message:  msg,
+		Details:  st.Proto().GetDetails(),
+	}
+}
+
+type statusErrorFormatter struct{}
+
+func (statusErrorFormatter) Format(_ *http.Request, status *ErrorStatus, encoder, _ MessageEncoder) ([]byte, string, error) {
+	body, err := encoder.Encode(&statusPkg.Error{
+		Code:    int32(status.HTTPCode), //nolint:gosec
+		Message: status.Message,
+		Details: status.Details,
+	})
+	return body, encoder.ContentType(), jErrors.Trace(err)
+}
+
+type grpcGatewayErrorFormatter struct{}
+
+func (grpcGatewayErrorFormatter) Format(_ *http.Request, status *ErrorStatus, encoder, _ MessageEncoder) ([]byte, string, error) {
+	body, err := encoder.Encode(&rpcStatus.Status{
+		Code:    int32(status.Code), //nolint:gosec
+		Message: status.Message,
+		Details: status.Details,
+	})
+	return body, encoder.ContentType(), jErrors.Trace(err)
+}
+
+// problemDetails is RFC 9457 problem details object, details of the status are carried by extension member.
+type problemDetails struct {
+	Type     string            `json:"type"`
+	Title    string            `json:"title"`
+	Status   int               `json:"status"`
+	Detail   string            `json:"detail,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Details  []json.RawMessage `json:"details,omitempty"`
+}
+
+type problemErrorFormatter struct{}
+
+func (problemErrorFormatter) Format(r *http.Request, status *ErrorStatus, _, jsonEncoder MessageEncoder) ([]byte, string, error) {
+	problem := problemDetails{
+		Type:     "about:blank",
+		Title:    http.StatusText(status.HTTPCode),
+		Status:   status.HTTPCode,
+		Detail:   status.Message,
+		Instance: r.URL.Path,
+	}
+	if problem.Detail == problem.Title {
+		problem.Detail = ""
+	}
+
+	for _, detail := range status.Details {
+		data, err := jsonEncoder.Encode(detail)
+		if err != nil {
+			return nil, "", jErrors.Trace(err)
+		}
+		problem.Details = append(problem.Details, data)
+	}
+
+	body, err := json.Marshal(problem)
+	return body, ContentTypeProblemJSON, jErrors.Trace(err)
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/eset/grpc-rest-proxy/pkg/service/jsonencoder"
+	routerPkg "github.com/eset/grpc-rest-proxy/pkg/service/router"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	grpcStatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func newErrorFormatEndpoint(t *testing.T, format string) *ProxyEndpoint {
+	t.Helper()
+
+	client := &testClient{handle: func(context.Context, *wrapperspb.StringValue) ([]proto.Message, error) {
+		st, err := grpcStatus.New(codes.NotFound, "user John not found").WithDetails(&errdetails.ErrorInfo{Reason: "USER_NOT_FOUND"})
+		require.NoError(t, err)
+		return nil, st.Err()
+	}}
+	route := routerPkg.NewRoute("/echo/{value}", "", routerPkg.GET, newTestSpec("Echo", false))
+	return newTestEndpoint(t, &ConfigHTTP{ErrorFormat: format}, client, route)
+}
+
+func TestStatusErrorFormat(t *testing.T) {
+	for _, format := range []string{"", StatusErrorFormat} {
+		w := serve(newErrorFormatEndpoint(t, format), http.MethodGet, "/echo/John", "", nil, nil)
+		require.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+		require.Equal(t, ContentTypeJSON, w.Header().Get(headerContentType))
+		require.JSONEq(t, `{
+			"code": 404,
+			"message": "user John not found",
+			"details": [{"@type": "type.googleapis.com/google.rpc.ErrorInfo", "reason": "USER_NOT_FOUND"}]
+		}`, w.Body.String())
+	}
+}
+
+func TestGRPCGatewayErrorFormat(t *testing.T) {
+	w := serve(newErrorFormatEndpoint(t, GRPCGatewayErrorFormat), http.MethodGet, "/echo/John", "", nil, nil)
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Equal(t, ContentTypeJSON, w.Header().Get(headerContentType))
+	require.JSONEq(t, `{
+		"code": 5,
+		"message": "user John not found",
+		"details": [{"@type": "type.googleapis.com/google.rpc.ErrorInfo", "reason": "USER_NOT_FOUND"}]
+	}`, w.Body.String())
+}
+
+func TestProblemErrorFormat(t *testing.T) {
+	endpoint := newErrorFormatEndpoint(t, ProblemErrorFormat)
+
+	w := serve(endpoint, http.MethodGet, "/echo/John", "", nil, nil)
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Equal(t, ContentTypeProblemJSON, w.Header().Get(headerContentType))
+	require.JSONEq(t, `{
+		"type": "about:blank",
+		"title": "Not Found",
+		"status": 404,
+		"detail": "user John not found",
+		"instance": "/echo/John",
+		"details": [{"@type": "type.googleapis.com/google.rpc.ErrorInfo", "reason": "USER_NOT_FOUND"}]
+	}`, w.Body.String())
+
+	// detail repeating the title is omitted
+	w = serve(endpoint, http.MethodGet, "/unknown", "", nil, nil)
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Equal(t, ContentTypeProblemJSON, w.Header().Get(headerContentType))
+	require.JSONEq(t, `{"type": "about:blank", "title": "Not Found", "status": 404, "instance": "/unknown"}`, w.Body.String())
+}
+
+type testErrorFormatter struct{}
+
+func (testErrorFormatter) Format(_ *http.Request, status *ErrorStatus, _, _ MessageEncoder) ([]byte, string, error) {
+	body, err := json.Marshal(map[string]any{"error": status.Message, "grpcCode": status.Code.String()})
+	return body, "application/vnd.error+json", err
+}
+
+func TestRegisterErrorFormatter(t *testing.T) {
+	encoder := jsonencoder.New(&jsonencoder.Config{}, nil)
+	_, err := NewProxyEndpoint(nil, &ConfigHTTP{ErrorFormat: "custom"}, routerPkg.NewRouter(), nil, nil, encoder, nil, nil)
+	require.ErrorContains(t, err, "unknown error format custom")
+
+	RegisterErrorFormatter("custom", testErrorFormatter{})
+	t.Cleanup(func() {
+		errorFormattersMu.Lock()
+		defer errorFormattersMu.Unlock()
+		delete(errorFormatters, "custom")
+	})
+
+	w := serve(newErrorFormatEndpoint(t, "custom"), http.MethodGet, "/echo/John", "", nil, nil)
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Equal(t, "application/vnd.error+json", w.Header().Get(headerContentType))
+	require.JSONEq(t, `{"error": "user John not found", "grpcCode": "NotFound"}`, w.Body.String())
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+package transport
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/eset/grpc-rest-proxy/pkg/service/transformer"
+	"github.com/eset/grpc-rest-proxy/pkg/transport/compression"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	grpcStatus "google.golang.org/grpc/status"
+)
+
+// requestError is client error caused by invalid fields of the request. Violations are reported
+// as google.rpc.BadRequest detail of the error response.
+type requestError struct {
+	message    string
+	violations []*errdetails.BadRequest_FieldViolation
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+// getRequestErrorStatus converts error of request conversion to the status of REST response.
+func (e *ProxyEndpoint) getRequestErrorStatus(err error) *ErrorStatus {
+	status := newHTTPErrorStatus(getRequestErrorCode(err))
+	if st := e.getBindingStatus(err); st != nil {
+		status.Code = st.Code()
+		status.Message = st.Message()
+		status.Details = st.Proto().GetDetails()
+		return status
+	}
+
+	if !e.hideDetails {
+		status.Message = err.Error()
+	}
+	return status
+}
+
+func getRequestErrorCode(err error) int {
+	switch {
+	case errors.Is(err, RequestTooLarge), errors.Is(err, transformer.PartTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, compression.UnsupportedEncoding), errors.Is(err, transformer.UnsupportedContentType):
+		return http.StatusUnsupportedMediaType
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// getBindingStatus returns InvalidArgument status with google.rpc.BadRequest detail for errors of binding
+// the request to the request message, nil is returned for other errors.
+func (e *ProxyEndpoint) getBindingStatus(err error) *grpcStatus.Status {
+	var reqErr *requestError
+	var fieldErr *transformer.FieldError
+	var bodyErr *transformer.BodyError
+
+	var message string
+	var violations []*errdetails.BadRequest_FieldViolation
+	switch {
+	case errors.As(err, &reqErr):
+		message = reqErr.message
+		violations = reqErr.violations
+	case errors.As(err, &fieldErr):
+		message = fieldErr.Kind.Error() + ": " + fieldErr.Field
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       fieldErr.Field,
+			Description: e.describeViolation(fieldErr.Kind.Error(), fieldErr.Err),
+		})
+	case errors.As(err, &bodyErr):
+		message = bodyErr.Reason()
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       bodyErr.Field,
+			Description: e.describeViolation(bodyErr.Reason(), bodyErr.Err),
+		})
+	default:
+		return nil
+	}
+
+	st := grpcStatus.New(codes.InvalidArgument, message)
+	if withDetails, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations}); err == nil {
+		return withDetails
+	}
+	return st
+}
+
+// describeViolation appends the underlying error to the reason unless details are hidden.
+func (e *ProxyEndpoint) describeViolation(reason string, err error) string {
+	if e.hideDetails || err == nil || err.Error() == reason {
+		return reason
+	}
+	return reason + ": " + err.Error()
+}
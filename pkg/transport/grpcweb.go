@@ -0,0 +1,117 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+package transport
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/eset/grpc-rest-proxy/pkg/service/transformer"
+
+	jErrors "github.com/juju/errors"
+
+	"google.golang.org/grpc/metadata"
+	grpcStatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const flagGRPCWebTrailer = 0x80
+
+// serveGRPCWeb proxies gRPC-Web request. Status and trailer metadata are sent in the trailer frame at the end
+// of the response body, so HTTP status is always 200 once the response is started.
+func (e *ProxyEndpoint) serveGRPCWeb(w http.ResponseWriter, call *rpcCall) {
+	r := call.httpRequest
+	rc := http.NewResponseController(w)
+
+	headerWritten := false
+	writeHeader := func(header metadata.MD) {
+		transformer.SetRESTHeaders(r.ProtoMajor, w.Header(), filterMetadata(header), call.contentType)
+		w.WriteHeader(http.StatusOK)
+		headerWritten = true
+	}
+
+	var trailer metadata.MD
+	request, err := e.readRPCRequest(call)
+	if err == nil {
+		trailer, err = e.invokeRPC(call, request, writeHeader, func(m proto.Message) error {
+			data, err := e.marshalRPCMessage(call, m)
+			if err != nil {
+				return jErrors.Trace(err)
+			}
+			if err = e.writeGRPCWebFrame(w, call, encodeEnvelope(0, data)); err != nil {
+				return jErrors.Trace(err)
+			}
+			return jErrors.Trace(rc.Flush())
+		})
+	}
+
+	if !headerWritten {
+		writeHeader(nil)
+	}
+
+	frame := encodeEnvelope(flagGRPCWebTrailer, encodeGRPCWebTrailer(e.getRPCStatus(r, err), trailer))
+	if err = e.writeGRPCWebFrame(w, call, frame); err != nil {
+		e.logger.ErrorContext(r.Context(), jErrors.Details(jErrors.Trace(err)))
+	}
+}
+
+func (e *ProxyEndpoint) writeGRPCWebFrame(w http.ResponseWriter, call *rpcCall, frame []byte) error {
+	if call.protocol == protocolGRPCWebText {
+		frame = []byte(base64.StdEncoding.EncodeToString(frame))
+	}
+	_, err := w.Write(frame)
+	return jErrors.Trace(err)
+}
+
+// encodeGRPCWebTrailer encodes status and trailer metadata as HTTP/1 header block.
+func encodeGRPCWebTrailer(st *grpcStatus.Status, trailer metadata.MD) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "grpc-status: %d\r\n", st.Code())
+	if st.Message() != "" {
+		fmt.Fprintf(&b, "grpc-message: %s\r\n", encodeGRPCMessage(st.Message()))
+	}
+	if len(st.Proto().GetDetails()) > 0 {
+		details, err := proto.Marshal(st.Proto())
+		if err == nil {
+			fmt.Fprintf(&b, "grpc-status-details-bin: %s\r\n", base64.RawStdEncoding.EncodeToString(details))
+		}
+	}
+
+	for key, values := range filterMetadata(trailer) {
+		for _, value := range values {
+			if strings.HasSuffix(key, "-bin") {
+				value = base64.RawStdEncoding.EncodeToString([]byte(value))
+			}
+			fmt.Fprintf(&b, "%s: %s\r\n", key, value)
+		}
+	}
+	return b.Bytes()
+}
+
+// encodeGRPCMessage percent-encodes status message as required by gRPC over HTTP2 specification.
+func encodeGRPCMessage(msg string) string {
+	var sb strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			sb.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&sb, "%%%02X", c)
+	}
+	return sb.String()
+}
+
+// filterMetadata drops metadata which are part of the protocol.
+func filterMetadata(md metadata.MD) metadata.MD {
+	filtered := metadata.MD{}
+	for key, values := range md {
+		if !isReservedMetadata(key) {
+			filtered[key] = values
+		}
+	}
+	return filtered
+}
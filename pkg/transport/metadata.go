@@ -0,0 +1,71 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+package transport
+
+import (
+	"net/http"
+	"strconv"
+
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// metadataHTTPCode is reserved metadata key by which backend overrides HTTP status of the response
+	metadataHTTPCode = "x-http-code"
+	// metadataHTTPStatus is alias of metadataHTTPCode, e.g. for redirects
+	metadataHTTPStatus = "x-http-status"
+)
+
+// metadataHeaders are reserved metadata keys which are sent to the client as given HTTP headers.
+var metadataHeaders = map[string]string{
+	"x-http-location":   "Location",
+	"x-http-set-cookie": "Set-Cookie",
+}
+
+// responseMetadata is part of HTTP response controlled by backend through reserved metadata keys.
+type responseMetadata struct {
+	// HTTP status code, zero when it is not set by backend
+	httpCode int
+	header   http.Header
+}
+
+// popResponseMetadata removes reserved keys from response metadata, so they are not forwarded as headers,
+// and returns their values. Trailer takes precedence over header. Status codes out of 200-599 are ignored, as
+// informational responses cannot be final.
+func popResponseMetadata(header, trailer metadata.MD) responseMetadata {
+	meta := responseMetadata{header: make(http.Header)}
+	for _, md := range []metadata.MD{header, trailer} {
+		for _, key := range []string{metadataHTTPCode, metadataHTTPStatus} {
+			values := md.Get(key)
+			if len(values) == 0 {
+				continue
+			}
+			md.Delete(key)
+
+			value, err := strconv.Atoi(values[len(values)-1])
+			if err == nil && value >= http.StatusOK && value <= 599 {
+				meta.httpCode = value
+			}
+		}
+
+		for key, name := range metadataHeaders {
+			for _, value := range md.Get(key) {
+				meta.header.Add(name, value)
+			}
+			md.Delete(key)
+		}
+	}
+	return meta
+}
+
+// apply sets headers and returns HTTP status code set by backend or the default one. Error responses keep their
+// default code unless backend sets another error code, so a failed call is never reported as success.
+func (meta responseMetadata) apply(header http.Header, defaultCode int) int {
+	for name, values := range meta.header {
+		header[name] = values
+	}
+	if meta.httpCode == 0 || (defaultCode >= http.StatusBadRequest && meta.httpCode < http.StatusBadRequest) {
+		return defaultCode
+	}
+	return meta.httpCode
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package transport
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestResponseMetadata(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		defaultCode int
+		expected    int
+	}{
+		{"created", "201", http.StatusOK, http.StatusCreated},
+		{"redirect", "302", http.StatusOK, http.StatusFound},
+		{"error of success", "409", http.StatusOK, http.StatusConflict},
+		{"informational", "101", http.StatusOK, http.StatusOK},
+		{"out of range", "600", http.StatusOK, http.StatusOK},
+		{"not a number", "created", http.StatusOK, http.StatusOK},
+		{"another error", "503", http.StatusNotFound, http.StatusServiceUnavailable},
+		{"success of error", "200", http.StatusNotFound, http.StatusNotFound},
+		{"redirect of error", "302", http.StatusInternalServerError, http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := metadata.Pairs(metadataHTTPCode, test.value, "x-http-location", "/api/users/1")
+			meta := popResponseMetadata(header, nil)
+			require.Empty(t, header, "reserved keys are not forwarded")
+
+			httpHeader := make(http.Header)
+			require.Equal(t, test.expected, meta.apply(httpHeader, test.defaultCode))
+			require.Equal(t, "/api/users/1", httpHeader.Get(headerLocation))
+		})
+	}
+
+	meta := popResponseMetadata(metadata.Pairs(metadataHTTPStatus, "201"), metadata.Pairs(metadataHTTPCode, "202"))
+	require.Equal(t, http.StatusAccepted, meta.apply(make(http.Header), http.StatusOK), "trailer takes precedence")
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+package transport
+
+import (
+	"bytes"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/eset/grpc-rest-proxy/pkg/service/jsonencoder"
+
+	jErrors "github.com/juju/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeNDJSON   = "application/x-ndjson"
+)
+
+// responseEncoder encodes response messages into representation of given content type.
+type responseEncoder interface {
+	ContentType() string
+	Encode(m proto.Message) ([]byte, error)
+}
+
+type jsonResponseEncoder struct {
+	jsonencoder.Encoder
+}
+
+func (jsonResponseEncoder) ContentType() string {
+	return ContentTypeJSON
+}
+
+type protobufResponseEncoder struct{}
+
+func (protobufResponseEncoder) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+func (protobufResponseEncoder) Encode(m proto.Message) ([]byte, error) {
+	response, err := proto.Marshal(m)
+	return response, jErrors.Trace(err)
+}
+
+// ndjsonResponseEncoder writes every item of the first repeated message field as separate JSON line.
+// Messages without such field are written as single line.
+type ndjsonResponseEncoder struct {
+	jsonencoder.Encoder
+}
+
+func (ndjsonResponseEncoder) ContentType() string {
+	return ContentTypeNDJSON
+}
+
+func (e ndjsonResponseEncoder) Encode(m proto.Message) ([]byte, error) {
+	msg := m.ProtoReflect()
+	fields := msg.Descriptor().Fields()
+
+	for idx := 0; idx < fields.Len(); idx++ {
+		field := fields.Get(idx)
+		if !field.IsList() || field.Kind() != protoreflect.MessageKind {
+			continue
+		}
+
+		var buf bytes.Buffer
+		list := msg.Get(field).List()
+		for itemIdx := 0; itemIdx < list.Len(); itemIdx++ {
+			line, err := e.Encoder.Encode(list.Get(itemIdx).Message().Interface())
+			if err != nil {
+				return nil, jErrors.Trace(err)
+			}
+			buf.Write(line)
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes(), nil
+	}
+
+	line, err := e.Encoder.Encode(m)
+	if err != nil {
+		return nil, jErrors.Trace(err)
+	}
+	return append(line, '\n'), nil
+}
+
+func newResponseEncoders(contentTypes []string, jsonEncoder jsonencoder.Encoder) []responseEncoder {
+	if len(contentTypes) == 0 {
+		return []responseEncoder{jsonResponseEncoder{jsonEncoder}}
+	}
+
+	encoders := make([]responseEncoder, 0, len(contentTypes))
+	for _, contentType := range contentTypes {
+		switch contentType {
+		case ContentTypeJSON:
+			encoders = append(encoders, jsonResponseEncoder{jsonEncoder})
+		case ContentTypeProtobuf:
+			encoders = append(encoders, protobufResponseEncoder{})
+		case ContentTypeNDJSON:
+			encoders = append(encoders, ndjsonResponseEncoder{jsonEncoder})
+		}
+	}
+	return encoders
+}
+
+// negotiateEncoder selects response encoder according to Accept header. Quality of each content type is
+// taken from the most specific matching media range. Encoders with the same quality are selected by order
+// of configured content types. Missing Accept header selects the first one.
+func (e *ProxyEndpoint) negotiateEncoder(accept string) (responseEncoder, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return e.encoders[0], true
+	}
+
+	ranges := parseAccept(accept)
+
+	var selected responseEncoder
+	var selectedQuality float64
+	for _, encoder := range e.encoders {
+		quality := 0.0
+		specificity := -1
+		for _, mr := range ranges {
+			rangeSpecificity := mr.match(encoder.ContentType())
+			if rangeSpecificity > specificity {
+				specificity = rangeSpecificity
+				quality = mr.quality
+			}
+		}
+
+		if quality > selectedQuality {
+			selected = encoder
+			selectedQuality = quality
+		}
+	}
+
+	return selected, selected != nil
+}
+
+type mediaRange struct {
+	mediaType string
+	quality   float64
+}
+
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if value, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType: mediaType, quality: quality})
+	}
+	return ranges
+}
+
+// match returns specificity of the media range matching given content type or -1 if it does not match.
+func (mr mediaRange) match(contentType string) int {
+	if mr.mediaType == contentType {
+		return 2 //nolint:mnd
+	}
+
+	rangeType, rangeSubtype, _ := strings.Cut(mr.mediaType, "/")
+	contentTypeType, _, _ := strings.Cut(contentType, "/")
+	switch {
+	case rangeType == "*" && rangeSubtype == "*":
+		return 0
+	case rangeSubtype == "*" && rangeType == contentTypeType:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// errorEncoder returns encoder of error responses. Only JSON and protobuf are used for errors.
+func (e *ProxyEndpoint) errorEncoder(encoder responseEncoder) responseEncoder {
+	if encoder.ContentType() == ContentTypeProtobuf {
+		return encoder
+	}
+	return e.jsonEncoder
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package transport
+
+import (
+	"net/http"
+	"testing"
+
+	userpb "github.com/eset/grpc-rest-proxy/cmd/examples/grpcserver/gen/user/v1"
+	"github.com/eset/grpc-rest-proxy/pkg/service/jsonencoder"
+	routerPkg "github.com/eset/grpc-rest-proxy/pkg/service/router"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateEncoder(t *testing.T) {
+	jsonEncoder := jsonencoder.New(&jsonencoder.Config{}, nil)
+	endpoint := &ProxyEndpoint{
+		encoders: newResponseEncoders([]string{ContentTypeJSON, ContentTypeProtobuf, ContentTypeNDJSON}, jsonEncoder),
+	}
+
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{"", ContentTypeJSON},
+		{"*/*", ContentTypeJSON},
+		{ContentTypeProtobuf, ContentTypeProtobuf},
+		{"application/*", ContentTypeJSON},
+		{"application/json;q=0.5, application/x-protobuf", ContentTypeProtobuf},
+		{"application/*;q=0.9, application/json;q=0.1", ContentTypeProtobuf},
+		{"*/*;q=0.1, application/x-ndjson", ContentTypeNDJSON},
+		{"application/x-ndjson;q=0.8, application/x-protobuf;q=0.8", ContentTypeProtobuf},
+		{"application/json;q=0, */*", ContentTypeProtobuf},
+		{"application/json;q=invalid, application/x-ndjson", ContentTypeNDJSON},
+		{"text/html", ""},
+		{"application/json;q=0", ""},
+	}
+
+	for _, test := range tests {
+		encoder, ok := endpoint.negotiateEncoder(test.accept)
+		if test.expected == "" {
+			require.False(t, ok, test.accept)
+			continue
+		}
+		require.True(t, ok, test.accept)
+		require.Equal(t, test.expected, encoder.ContentType(), test.accept)
+	}
+}
+
+func TestNDJSONEncoder(t *testing.T) {
+	encoder := ndjsonResponseEncoder{jsonencoder.New(&jsonencoder.Config{}, nil)}
+
+	data, err := encoder.Encode(&userpb.GetUsersResponse{Users: []*userpb.User{{Username: "John"}, {Username: "Diego"}}})
+	require.NoError(t, err)
+	require.Equal(t, "{\"username\":\"John\"}\n{\"username\":\"Diego\"}\n", string(data))
+
+	data, err = encoder.Encode(&userpb.GetUsersResponse{})
+	require.NoError(t, err)
+	require.Empty(t, data, "empty list is written as no lines")
+
+	data, err = encoder.Encode(&userpb.User{Username: "John"})
+	require.NoError(t, err)
+	require.Equal(t, "{\"username\":\"John\"}\n", string(data), "message without list is written as single line")
+}
+
+func TestUnsupportedRequestContentType(t *testing.T) {
+	route := routerPkg.NewRoute("/echo", "*", routerPkg.POST, newTestSpec("Echo", false))
+	endpoint := newTestEndpoint(t, &ConfigHTTP{}, &testClient{handle: echo}, route)
+
+	w := serve(endpoint, http.MethodPost, "/echo", "application/xml", []byte("<value>John</value>"), nil)
+	require.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	w = serve(endpoint, http.MethodPost, "/echo", "text/plain", []byte(`"John"`), nil)
+	require.Equal(t, http.StatusOK, w.Code, "text/plain is decoded as JSON")
+	require.JSONEq(t, `"hello John"`, w.Body.String())
+}
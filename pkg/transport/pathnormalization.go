@@ -0,0 +1,112 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+package transport
+
+import "strings"
+
+// NormalizationMode decides how a request path differing from the canonical path is handled.
+type NormalizationMode string
+
+const (
+	// NormalizationOff matches the path as it is
+	NormalizationOff NormalizationMode = "off"
+	// NormalizationRewrite matches the canonical path silently
+	NormalizationRewrite NormalizationMode = "rewrite"
+	// NormalizationRedirect answers with 308 Permanent Redirect to the canonical path
+	NormalizationRedirect NormalizationMode = "redirect"
+)
+
+// PathNormalizationConfig enables normalization of paths which do not match any route as they are.
+type PathNormalizationConfig struct {
+	// trailing slashes are removed, e.g. /v1/users/ is /v1/users
+	TrailingSlash NormalizationMode `mapstructure:"trailingSlash" validate:"omitempty,oneof=off rewrite redirect"`
+	// duplicate slashes are collapsed, e.g. //v1//users is /v1/users
+	DuplicateSlashes NormalizationMode `mapstructure:"duplicateSlashes" validate:"omitempty,oneof=off rewrite redirect"`
+	// dot segments are resolved, e.g. /v1/./groups/../users is /v1/users
+	DotSegments NormalizationMode `mapstructure:"dotSegments" validate:"omitempty,oneof=off rewrite redirect"`
+	// literal segments and verbs of route patterns are matched regardless of case
+	CaseInsensitive bool `mapstructure:"caseInsensitive"`
+}
+
+type pathNormalizer struct {
+	trailingSlash    NormalizationMode
+	duplicateSlashes NormalizationMode
+	dotSegments      NormalizationMode
+}
+
+func newPathNormalizer(conf *PathNormalizationConfig) *pathNormalizer {
+	if conf == nil {
+		return nil
+	}
+	return &pathNormalizer{
+		trailingSlash:    conf.TrailingSlash,
+		duplicateSlashes: conf.DuplicateSlashes,
+		dotSegments:      conf.DotSegments,
+	}
+}
+
+// normalize returns canonical form of escaped path. Redirect is reported when any of the normalizations which
+// changed the path is configured to redirect.
+func (n *pathNormalizer) normalize(path string) (normalized string, redirect bool) {
+	if n == nil {
+		return path, false
+	}
+
+	steps := []struct {
+		mode      NormalizationMode
+		normalize func(string) string
+	}{
+		{n.duplicateSlashes, collapseSlashes},
+		{n.dotSegments, removeDotSegments},
+		{n.trailingSlash, trimTrailingSlash},
+	}
+
+	normalized = path
+	for _, step := range steps {
+		if step.mode != NormalizationRewrite && step.mode != NormalizationRedirect {
+			continue
+		}
+
+		next := step.normalize(normalized)
+		if next != normalized && step.mode == NormalizationRedirect {
+			redirect = true
+		}
+		normalized = next
+	}
+	return normalized, redirect
+}
+
+func collapseSlashes(path string) string {
+	for strings.Contains(path, "//") {
+		path = strings.ReplaceAll(path, "//", "/")
+	}
+	return path
+}
+
+// removeDotSegments resolves . and .. segments as RFC 3986 does, .. never leaves the root.
+func removeDotSegments(path string) string {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	resolved := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		switch segment {
+		case ".":
+		case "..":
+			if len(resolved) > 0 {
+				resolved = resolved[:len(resolved)-1]
+			}
+		default:
+			resolved = append(resolved, segment)
+			continue
+		}
+
+		// path ending by dot segment addresses a directory
+		if i == len(segments)-1 {
+			resolved = append(resolved, "")
+		}
+	}
+	return "/" + strings.Join(resolved, "/")
+}
+
+func trimTrailingSlash(path string) string {
+	return "/" + strings.TrimRight(strings.TrimPrefix(path, "/"), "/")
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package transport
+
+import (
+	"net/http"
+	"testing"
+
+	routerPkg "github.com/eset/grpc-rest-proxy/pkg/service/router"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoveDotSegments(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/", "/"},
+		{"/v1/users", "/v1/users"},
+		{"/..", "/"},
+		{"/../..", "/"},
+		{"/.", "/"},
+		{"/a/./b/../c/", "/a/c/"},
+		{"/a/b/..", "/a/"},
+		{"/a/..b/.c", "/a/..b/.c"},
+		{"/a/..%2Fb", "/a/..%2Fb"},
+		{"/a/%2E%2E/b", "/a/%2E%2E/b"},
+		{"//host/../a", "//a"},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, removeDotSegments(test.path), test.path)
+	}
+}
+
+func TestTrimTrailingSlash(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/", "/"},
+		{"//", "/"},
+		{"/v1/users", "/v1/users"},
+		{"/v1/users/", "/v1/users"},
+		{"/v1/users///", "/v1/users"},
+		{"//host/", "//host"},
+		{"/v1/users%2F", "/v1/users%2F"},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, trimTrailingSlash(test.path), test.path)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	redirectAll := newPathNormalizer(&PathNormalizationConfig{
+		TrailingSlash:    NormalizationRedirect,
+		DuplicateSlashes: NormalizationRedirect,
+		DotSegments:      NormalizationRedirect,
+	})
+	rewriteDots := newPathNormalizer(&PathNormalizationConfig{
+		TrailingSlash: NormalizationRedirect,
+		DotSegments:   NormalizationRewrite,
+	})
+	off := newPathNormalizer(&PathNormalizationConfig{TrailingSlash: NormalizationOff})
+
+	tests := []struct {
+		name       string
+		normalizer *pathNormalizer
+		path       string
+		expected   string
+		redirect   bool
+	}{
+		{"disabled", nil, "//v1/./users/", "//v1/./users/", false},
+		{"off", off, "/v1/users/", "/v1/users/", false},
+		{"canonical", redirectAll, "/v1/users", "/v1/users", false},
+		{"all steps", redirectAll, "//v1//groups/../users/./", "/v1/users", true},
+		{"leading slashes", redirectAll, "//host/", "/host", true},
+		{"encoded slash", redirectAll, "/v1/users%2F..%2F", "/v1/users%2F..%2F", false},
+		{"rewrite", rewriteDots, "/v1/a/../users", "/v1/users", false},
+		{"rewrite and redirect", rewriteDots, "/v1/a/../users/", "/v1/users", true},
+		{"trailing slash only", rewriteDots, "//host/", "//host", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			normalized, redirect := test.normalizer.normalize(test.path)
+			require.Equal(t, test.expected, normalized)
+			require.Equal(t, test.redirect, redirect)
+		})
+	}
+}
+
+func TestNormalizationRedirect(t *testing.T) {
+	conf := &ConfigHTTP{PathNormalization: &PathNormalizationConfig{TrailingSlash: NormalizationRedirect}}
+	endpoint := newTestEndpoint(t, conf, &testClient{handle: echo},
+		routerPkg.NewRoute("/echo/{value}", "", routerPkg.GET, newTestSpec("Echo", false)),
+		routerPkg.NewRoute("/*/{value}", "", routerPkg.GET, newTestSpec("Echo", false)),
+	)
+
+	w := serve(endpoint, http.MethodGet, "/echo/John/?q=1", "", nil, nil)
+	require.Equal(t, http.StatusPermanentRedirect, w.Code)
+	require.Equal(t, "/echo/John?q=1", w.Header().Get(headerLocation))
+
+	// protocol-relative location would redirect to another host, so the route is served instead
+	w = serve(endpoint, http.MethodGet, "//evil.com/", "", nil, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Empty(t, w.Header().Get(headerLocation))
+	require.JSONEq(t, `"hello evil.com"`, w.Body.String())
+}
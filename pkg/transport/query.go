@@ -0,0 +1,80 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+package transport
+
+import (
+	"cmp"
+	"net/url"
+	"slices"
+
+	routerPkg "github.com/eset/grpc-rest-proxy/pkg/service/router"
+	"github.com/eset/grpc-rest-proxy/pkg/service/transformer"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+// QueryParamsPolicy decides what happens with query parameters which do not address any field of the request.
+type QueryParamsPolicy string
+
+const (
+	// QueryParamsStrict rejects request with unknown query parameters
+	QueryParamsStrict QueryParamsPolicy = "strict"
+	// QueryParamsLenient ignores unknown query parameters
+	QueryParamsLenient QueryParamsPolicy = "lenient"
+)
+
+// getQueryVariables converts query parameters to variables of the request message. Parameters which address
+// a field colliding with path variables or with fields bound to a non-empty body are always rejected, as HttpRule
+// specification requires. Unknown parameters are ignored in lenient mode before any collision is checked.
+func (e *ProxyEndpoint) getQueryVariables(
+	route *routerPkg.Match,
+	queryValues url.Values,
+	hasBody bool,
+) ([]transformer.Variable, error) {
+	var queryVariables []transformer.Variable
+	var violations []*errdetails.BadRequest_FieldViolation
+
+	for name, values := range queryValues {
+		fieldPath := transformer.ParseFieldPath(name)
+		// resolved path uses proto names, so it can be compared with path variables and body field
+		resolved, known := transformer.ResolveFieldPath(route.GrpcSpec.RequestDesc, fieldPath, e.fieldNaming)
+		if !known && e.queryParams == QueryParamsLenient {
+			continue
+		}
+
+		description := ""
+		switch {
+		case !known:
+			description = "unknown query parameter"
+		case hasBody && route.BodyRule.RuleType == transformer.MapRootRule:
+			description = "query parameters are not allowed, whole request message is bound to the body"
+		case hasBody && route.BodyRule.RuleType == transformer.FieldPathRule && overlaps(resolved, route.BodyRule.FieldPath):
+			description = "parameter collides with field bound to the body"
+		case slices.ContainsFunc(route.Params, func(v transformer.Variable) bool { return overlaps(resolved, v.FieldPath) }):
+			description = "parameter collides with path variable"
+		}
+
+		if description != "" {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: name, Description: description})
+			continue
+		}
+
+		for _, value := range values {
+			queryVariables = append(queryVariables, transformer.Variable{FieldPath: resolved, Value: value, CommaSeparated: true})
+		}
+	}
+
+	if len(violations) > 0 {
+		slices.SortFunc(violations, func(a, b *errdetails.BadRequest_FieldViolation) int {
+			return cmp.Compare(a.GetField(), b.GetField())
+		})
+		return nil, &requestError{message: "invalid query parameters", violations: violations}
+	}
+	return queryVariables, nil
+}
+
+// overlaps reports whether one field path is prefix of the other one.
+func overlaps(a, b []string) bool {
+	n := min(len(a), len(b))
+	return slices.Equal(a[:n], b[:n])
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package transport
+
+import (
+	"net/url"
+	"testing"
+
+	userpb "github.com/eset/grpc-rest-proxy/cmd/examples/grpcserver/gen/user/v1"
+	routerPkg "github.com/eset/grpc-rest-proxy/pkg/service/router"
+	"github.com/eset/grpc-rest-proxy/pkg/service/transformer"
+
+	"github.com/stretchr/testify/require"
+)
+
+func findTestRoute(t *testing.T, pattern, body, path string) *routerPkg.Match {
+	t.Helper()
+
+	router := routerPkg.NewRouter()
+	spec := &routerPkg.GrpcSpec{
+		RequestDesc: (&userpb.GetUserRequest{}).ProtoReflect().Descriptor(),
+		Service:     "user.v1.UserService",
+		Method:      "GetUser",
+	}
+	require.NoError(t, router.Push(routerPkg.NewRoute(pattern, body, routerPkg.GET, spec)))
+
+	match := router.Find(routerPkg.GET, path)
+	require.NotNil(t, match)
+	return match
+}
+
+func requireViolations(t *testing.T, err error, expected map[string]string) {
+	t.Helper()
+
+	var reqErr *requestError
+	require.ErrorAs(t, err, &reqErr)
+	violations := make(map[string]string)
+	for _, violation := range reqErr.violations {
+		violations[violation.GetField()] = violation.GetDescription()
+	}
+	require.Equal(t, expected, violations)
+}
+
+func TestQueryVariablesWholeBody(t *testing.T) {
+	route := findTestRoute(t, "/api/user/{username}", "*", "/api/user/John")
+	query := url.Values{"country": {"US"}, "unknown": {"1"}}
+
+	lenient := &ProxyEndpoint{queryParams: QueryParamsLenient}
+	variables, err := lenient.getQueryVariables(route, query, false)
+	require.NoError(t, err, "request without body accepts query parameters")
+	require.Equal(t, []transformer.Variable{{FieldPath: []string{"country"}, Value: "US", CommaSeparated: true}}, variables)
+
+	_, err = lenient.getQueryVariables(route, url.Values{"unknown": {"1"}}, true)
+	require.NoError(t, err, "unknown parameters are ignored before collisions are checked")
+
+	_, err = lenient.getQueryVariables(route, query, true)
+	requireViolations(t, err, map[string]string{
+		"country": "query parameters are not allowed, whole request message is bound to the body",
+	})
+
+	strict := &ProxyEndpoint{queryParams: QueryParamsStrict}
+	_, err = strict.getQueryVariables(route, query, true)
+	requireViolations(t, err, map[string]string{
+		"country": "query parameters are not allowed, whole request message is bound to the body",
+		"unknown": "unknown query parameter",
+	})
+}
+
+func TestQueryVariablesCollisions(t *testing.T) {
+	route := findTestRoute(t, "/api/user/{username}", "job", "/api/user/John")
+	endpoint := &ProxyEndpoint{queryParams: QueryParamsStrict}
+
+	_, err := endpoint.getQueryVariables(route, url.Values{"username": {"Diego"}, "job.job_title": {"CEO"}}, true)
+	requireViolations(t, err, map[string]string{
+		"username":      "parameter collides with path variable",
+		"job.job_title": "parameter collides with field bound to the body",
+	})
+
+	variables, err := endpoint.getQueryVariables(route, url.Values{"jobs": {"CEO"}, "country": {"US"}}, true)
+	require.Nil(t, variables)
+	requireViolations(t, err, map[string]string{"jobs": "unknown query parameter"})
+
+	variables, err = endpoint.getQueryVariables(route, url.Values{"job.jobTitle": {"CEO"}}, false)
+	require.NoError(t, err)
+	require.Equal(t, []transformer.Variable{{FieldPath: []string{"job", "job_title"}, Value: "CEO", CommaSeparated: true}}, variables)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+package transport
+
+import (
+	"net/http"
+	"regexp"
+
+	jErrors "github.com/juju/errors"
+)
+
+// headerOriginalPath carries path of the request before rewrite to the backend as metadata x-original-path.
+const headerOriginalPath = "X-Original-Path"
+
+// RewriteConfig rewrites escaped paths matching regular expression before routes are matched. Replacement is
+// a template referring to submatches, e.g. match ^/v1/(.*)$ and replacement /api/v2/$1.
+type RewriteConfig struct {
+	Match       string `mapstructure:"match" validate:"required"`
+	Replacement string `mapstructure:"replacement"`
+}
+
+type pathRewrite struct {
+	regex       *regexp.Regexp
+	replacement string
+}
+
+type pathRewriter []pathRewrite
+
+func newPathRewriter(confs []*RewriteConfig) (pathRewriter, error) {
+	rewriter := make(pathRewriter, 0, len(confs))
+	for _, conf := range confs {
+		regex, err := regexp.Compile(conf.Match)
+		if err != nil {
+			return nil, jErrors.Annotatef(err, "invalid rewrite %s", conf.Match)
+		}
+		rewriter = append(rewriter, pathRewrite{regex: regex, replacement: conf.Replacement})
+	}
+	return rewriter, nil
+}
+
+// rewrite returns the path rewritten by the first matching rewrite.
+func (p pathRewriter) rewrite(path string) (string, bool) {
+	for _, rewrite := range p {
+		match := rewrite.regex.FindStringSubmatchIndex(path)
+		if match == nil {
+			continue
+		}
+
+		var rewritten []byte
+		rewritten = append(rewritten, path[:match[0]]...)
+		rewritten = rewrite.regex.ExpandString(rewritten, rewrite.replacement, path, match)
+		rewritten = append(rewritten, path[match[1]:]...)
+		return string(rewritten), true
+	}
+	return path, false
+}
+
+// rewriteRequestPath returns escaped path of the request to be routed. Original path of rewritten request
+// is forwarded to the backend, the header sent by the client is dropped to prevent spoofing.
+func (p pathRewriter) rewriteRequestPath(r *http.Request) (string, bool) {
+	r.Header.Del(headerOriginalPath)
+
+	path := r.URL.EscapedPath()
+	rewritten, ok := p.rewrite(path)
+	if ok {
+		r.Header.Set(headerOriginalPath, path)
+	}
+	return rewritten, ok
+}
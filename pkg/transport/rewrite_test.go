@@ -0,0 +1,60 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteRequestPath(t *testing.T) {
+	rewriter, err := newPathRewriter([]*RewriteConfig{
+		{Match: "^/v1/(.*)$", Replacement: "/api/v2/$1"},
+		{Match: "^/legacy", Replacement: "/api"},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		path      string
+		expected  string
+		rewritten bool
+	}{
+		{"/v1/users/John", "/api/v2/users/John", true},
+		{"/legacy/users", "/api/users", true},
+		{"/v1/a%2Fb", "/api/v2/a%2Fb", true},
+		{"/api/users", "/api/users", false},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, test.path, nil)
+		r.Header.Set(headerOriginalPath, "/spoofed")
+
+		path, rewritten := rewriter.rewriteRequestPath(r)
+		require.Equal(t, test.expected, path)
+		require.Equal(t, test.rewritten, rewritten)
+		if test.rewritten {
+			require.Equal(t, test.path, r.Header.Get(headerOriginalPath))
+		} else {
+			require.Empty(t, r.Header.Get(headerOriginalPath), "header sent by the client is dropped")
+		}
+	}
+
+	_, err = newPathRewriter([]*RewriteConfig{{Match: "^/v1/(", Replacement: "/"}})
+	require.Error(t, err)
+}
+
+func TestRewriteRequestPathWithoutRewrites(t *testing.T) {
+	var rewriter pathRewriter
+
+	r := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	r.Header.Set(headerOriginalPath, "/spoofed")
+
+	path, rewritten := rewriter.rewriteRequestPath(r)
+	require.Equal(t, "/api/users", path)
+	require.False(t, rewritten)
+	require.Empty(t, r.Header.Get(headerOriginalPath), "header sent by the client is dropped when no rewrite is configured")
+}
@@ -0,0 +1,342 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+package transport
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	routerPkg "github.com/eset/grpc-rest-proxy/pkg/service/router"
+	"github.com/eset/grpc-rest-proxy/pkg/service/transformer"
+	"github.com/eset/grpc-rest-proxy/pkg/transport/compression"
+
+	jErrors "github.com/juju/errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	grpcStatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	InvalidEnvelope = jErrors.ConstError("invalid message envelope")
+
+	headerGRPCTimeout         = "Grpc-Timeout"
+	headerConnectTimeout      = "Connect-Timeout-Ms"
+	headerConnectProtoVersion = "Connect-Protocol-Version"
+
+	contentTypeGRPCWeb       = "application/grpc-web"
+	contentTypeGRPCWebProto  = "application/grpc-web+proto"
+	contentTypeGRPCWebText   = "application/grpc-web-text"
+	contentTypeGRPCWebTextPB = "application/grpc-web-text+proto"
+	contentTypeConnectProto  = "application/connect+proto"
+	contentTypeConnectJSON   = "application/connect+json"
+	contentTypeProto         = "application/proto"
+
+	envelopeHeaderSize = 5
+	flagCompressed     = 0x01
+)
+
+type rpcProtocol int
+
+const (
+	protocolGRPCWeb rpcProtocol = iota
+	protocolGRPCWebText
+	protocolConnectUnary
+	protocolConnectStream
+)
+
+// rpcCall holds state of a single gRPC-Web or Connect request addressed to gRPC method by its path.
+type rpcCall struct {
+	httpRequest *http.Request
+	protocol    rpcProtocol
+	spec        *routerPkg.GrpcSpec
+	// messages are encoded as JSON instead of binary protobuf
+	json bool
+	// content type of the response
+	contentType string
+}
+
+// matchRPC detects gRPC-Web and Connect requests by their content type. Only paths of known methods are matched.
+// Content types of Connect unary requests are shared with REST routes, so these requests are matched only when they
+// carry Connect-Protocol-Version header, other requests are left to REST routes.
+func (e *ProxyEndpoint) matchRPC(r *http.Request) (*rpcCall, bool) {
+	if e.rpcConf == nil {
+		return nil, false
+	}
+
+	spec, ok := e.methods[r.URL.Path]
+	if !ok {
+		return nil, false
+	}
+
+	call := &rpcCall{httpRequest: r, spec: spec}
+	if r.Method == http.MethodGet {
+		if !e.rpcConf.Connect || r.URL.Query().Get("connect") != "v1" {
+			return nil, false
+		}
+		call.protocol = protocolConnectUnary
+		call.json = r.URL.Query().Get("encoding") == "json"
+		call.contentType = connectUnaryContentType(call.json)
+		return call, true
+	}
+
+	if r.Method != http.MethodPost {
+		return nil, false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get(headerContentType))
+	if err != nil {
+		return nil, false
+	}
+
+	switch {
+	case e.rpcConf.GRPCWeb && (mediaType == contentTypeGRPCWeb || mediaType == contentTypeGRPCWebProto):
+		call.protocol, call.contentType = protocolGRPCWeb, contentTypeGRPCWebProto
+	case e.rpcConf.GRPCWeb && (mediaType == contentTypeGRPCWebText || mediaType == contentTypeGRPCWebTextPB):
+		call.protocol, call.contentType = protocolGRPCWebText, contentTypeGRPCWebTextPB
+	case e.rpcConf.Connect && (mediaType == contentTypeConnectProto || mediaType == contentTypeConnectJSON):
+		call.protocol, call.contentType = protocolConnectStream, mediaType
+		call.json = mediaType == contentTypeConnectJSON
+	case e.rpcConf.Connect && (mediaType == contentTypeProto || mediaType == ContentTypeJSON) &&
+		r.Header.Get(headerConnectProtoVersion) != "":
+		call.protocol, call.contentType = protocolConnectUnary, mediaType
+		call.json = mediaType == ContentTypeJSON
+	default:
+		return nil, false
+	}
+	return call, true
+}
+
+func connectUnaryContentType(json bool) string {
+	if json {
+		return ContentTypeJSON
+	}
+	return contentTypeProto
+}
+
+func (e *ProxyEndpoint) serveRPC(w http.ResponseWriter, call *rpcCall) {
+	switch call.protocol {
+	case protocolGRPCWeb, protocolGRPCWebText:
+		e.serveGRPCWeb(w, call)
+	case protocolConnectUnary:
+		e.serveConnectUnary(w, call)
+	case protocolConnectStream:
+		e.serveConnectStream(w, call)
+	}
+}
+
+// readRPCRequest reads single enveloped request message of streaming protocols.
+func (e *ProxyEndpoint) readRPCRequest(call *rpcCall) (*dynamicpb.Message, error) {
+	body, err := readRequestBody(call.httpRequest, e.maxRequestSize)
+	if err != nil {
+		return nil, jErrors.Trace(err)
+	}
+
+	if call.protocol == protocolGRPCWebText {
+		body, err = base64.StdEncoding.DecodeString(string(body))
+		if err != nil {
+			return nil, jErrors.Wrap(err, InvalidEnvelope)
+		}
+	}
+
+	if len(body) < envelopeHeaderSize {
+		return nil, jErrors.Trace(InvalidEnvelope)
+	}
+	if body[0]&flagCompressed != 0 {
+		return nil, jErrors.Annotate(compression.UnsupportedEncoding, "compressed messages are not supported")
+	}
+
+	size := binary.BigEndian.Uint32(body[1:envelopeHeaderSize])
+	if uint64(size) != uint64(len(body)-envelopeHeaderSize) {
+		return nil, jErrors.Trace(InvalidEnvelope)
+	}
+
+	return e.unmarshalRPCMessage(call, body[envelopeHeaderSize:])
+}
+
+func (e *ProxyEndpoint) unmarshalRPCMessage(call *rpcCall, data []byte) (*dynamicpb.Message, error) {
+	msg := dynamicpb.NewMessage(call.spec.RequestDesc)
+
+	var err error
+	if call.json {
+		err = protojson.Unmarshal(data, msg)
+	} else {
+		err = proto.Unmarshal(data, msg)
+	}
+	if err != nil {
+		return nil, jErrors.Trace(err)
+	}
+	return msg, nil
+}
+
+func (e *ProxyEndpoint) marshalRPCMessage(call *rpcCall, msg proto.Message) ([]byte, error) {
+	if call.json {
+		data, err := e.jsonEncoder.Encode(msg)
+		return data, jErrors.Trace(err)
+	}
+	data, err := proto.Marshal(msg)
+	return data, jErrors.Trace(err)
+}
+
+// invokeRPC calls unary or server streaming method. Header metadata is passed to onHeader before the first
+// response message is passed to send. Client streaming methods are not supported.
+func (e *ProxyEndpoint) invokeRPC(
+	call *rpcCall,
+	request proto.Message,
+	onHeader func(metadata.MD),
+	send func(proto.Message) error,
+) (metadata.MD, error) {
+	if call.spec.ClientStreaming {
+		return nil, grpcStatus.Error(codes.Unimplemented, "client streaming methods are not supported")
+	}
+
+	ctx, cancel, err := getRPCContext(call.httpRequest)
+	if err != nil {
+		return nil, grpcStatus.Error(codes.InvalidArgument, err.Error())
+	}
+	defer cancel()
+
+	if !call.spec.ServerStreaming {
+		var header, trailer metadata.MD
+		response := transformer.GetRPCResponse(call.spec.ResponseDesc)
+		err = e.client.Invoke(ctx, call.spec.FullPath(), request, response, grpc.Header(&header), grpc.Trailer(&trailer))
+		onHeader(header)
+		if err != nil {
+			return trailer, err //nolint:wrapcheck
+		}
+		return trailer, send(response)
+	}
+
+	desc := &grpc.StreamDesc{StreamName: call.spec.Method, ServerStreams: true}
+	stream, err := e.client.NewStream(ctx, desc, call.spec.FullPath())
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	if err = stream.SendMsg(request); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	if err = stream.CloseSend(); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	header, err := stream.Header()
+	onHeader(header)
+	if err != nil {
+		return stream.Trailer(), err //nolint:wrapcheck
+	}
+
+	for {
+		response := transformer.GetRPCResponse(call.spec.ResponseDesc)
+		err = stream.RecvMsg(response)
+		if errors.Is(err, io.EOF) {
+			return stream.Trailer(), nil
+		}
+		if err != nil {
+			return stream.Trailer(), err //nolint:wrapcheck
+		}
+		if err = send(response); err != nil {
+			return stream.Trailer(), jErrors.Trace(err)
+		}
+	}
+}
+
+// getRPCContext creates context of upstream request limited by timeout requested by the client.
+func getRPCContext(r *http.Request) (context.Context, context.CancelFunc, error) {
+	ctx := transformer.GetRPCRequestContext(r)
+
+	var timeout time.Duration
+	var err error
+	switch {
+	case r.Header.Get(headerGRPCTimeout) != "":
+		timeout, err = parseGRPCTimeout(r.Header.Get(headerGRPCTimeout))
+	case r.Header.Get(headerConnectTimeout) != "":
+		var ms uint64
+		ms, err = strconv.ParseUint(r.Header.Get(headerConnectTimeout), 10, 32)
+		timeout = time.Duration(ms) * time.Millisecond
+	default:
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, nil
+	}
+	if err != nil {
+		return nil, nil, jErrors.Annotate(err, "invalid timeout")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, nil
+}
+
+// parseGRPCTimeout parses timeout in format defined by gRPC over HTTP2 specification, e.g. 100m or 5S.
+func parseGRPCTimeout(value string) (time.Duration, error) {
+	if len(value) < 2 { //nolint:mnd
+		return 0, jErrors.Errorf("malformed timeout %q", value)
+	}
+
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+	unit, ok := units[value[len(value)-1]]
+	if !ok {
+		return 0, jErrors.Errorf("unknown timeout unit in %q", value)
+	}
+
+	amount, err := strconv.ParseUint(value[:len(value)-1], 10, 32)
+	if err != nil {
+		return 0, jErrors.Trace(err)
+	}
+	return time.Duration(amount) * unit, nil
+}
+
+// getRPCStatus converts error of request processing to gRPC status reported to the client.
+func (e *ProxyEndpoint) getRPCStatus(r *http.Request, err error) *grpcStatus.Status {
+	if st, ok := grpcStatus.FromError(err); ok {
+		return st
+	}
+
+	e.logger.ErrorContext(r.Context(), jErrors.Details(err))
+	if st := e.getBindingStatus(err); st != nil {
+		return st
+	}
+
+	switch {
+	case errors.Is(err, RequestTooLarge):
+		return grpcStatus.New(codes.ResourceExhausted, RequestTooLarge.Error())
+	case errors.Is(err, compression.UnsupportedEncoding):
+		return grpcStatus.New(codes.Unimplemented, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return grpcStatus.New(codes.DeadlineExceeded, err.Error())
+	case e.hideDetails:
+		return grpcStatus.New(codes.InvalidArgument, "invalid request")
+	default:
+		return grpcStatus.New(codes.InvalidArgument, err.Error())
+	}
+}
+
+// encodeEnvelope prefixes message with flags and its length as defined by gRPC and Connect streaming protocols.
+func encodeEnvelope(flags byte, data []byte) []byte {
+	frame := make([]byte, envelopeHeaderSize, envelopeHeaderSize+len(data))
+	frame[0] = flags
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data))) //nolint:gosec
+	return append(frame, data...)
+}
+
+// isReservedMetadata reports whether metadata key is part of the protocol and must not be forwarded as is.
+func isReservedMetadata(key string) bool {
+	return strings.HasPrefix(key, "grpc-") || key == "content-type" || key == "content-length"
+}
@@ -0,0 +1,516 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eset/grpc-rest-proxy/pkg/service/jsonencoder"
+	routerPkg "github.com/eset/grpc-rest-proxy/pkg/service/router"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	grpcStatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	testEchoPath  = "/test.Service/Echo"
+	testWatchPath = "/test.Service/Watch"
+)
+
+// testClient answers calls by handle, unary calls receive the first response only.
+type testClient struct {
+	handle  func(ctx context.Context, request *wrapperspb.StringValue) ([]proto.Message, error)
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+func (c *testClient) Invoke(ctx context.Context, _ string, args, reply any, opts ...grpc.CallOption) error {
+	responses, err := c.call(ctx, args)
+	for _, opt := range opts {
+		switch opt := opt.(type) {
+		case grpc.HeaderCallOption:
+			*opt.HeaderAddr = c.header
+		case grpc.TrailerCallOption:
+			*opt.TrailerAddr = c.trailer
+		}
+	}
+	if err == nil && len(responses) > 0 {
+		proto.Merge(reply.(proto.Message), responses[0])
+	}
+	return err
+}
+
+func (c *testClient) NewStream(ctx context.Context, _ *grpc.StreamDesc, _ string, _ ...grpc.CallOption) (grpc.ClientStream, error) {
+	return &testStream{ctx: ctx, client: c}, nil
+}
+
+func (c *testClient) Close() error {
+	return nil
+}
+
+func (c *testClient) call(ctx context.Context, args any) ([]proto.Message, error) {
+	data, err := proto.Marshal(args.(proto.Message))
+	if err != nil {
+		return nil, err
+	}
+	request := &wrapperspb.StringValue{}
+	if err = proto.Unmarshal(data, request); err != nil {
+		return nil, err
+	}
+	return c.handle(ctx, request)
+}
+
+type testStream struct {
+	grpc.ClientStream
+	ctx       context.Context
+	client    *testClient
+	responses []proto.Message
+	err       error
+}
+
+func (s *testStream) SendMsg(m any) error {
+	s.responses, s.err = s.client.call(s.ctx, m)
+	return nil
+}
+
+func (s *testStream) CloseSend() error {
+	return nil
+}
+
+func (s *testStream) Header() (metadata.MD, error) {
+	return s.client.header, nil
+}
+
+func (s *testStream) Trailer() metadata.MD {
+	return s.client.trailer
+}
+
+func (s *testStream) RecvMsg(m any) error {
+	if len(s.responses) == 0 {
+		if s.err != nil {
+			return s.err
+		}
+		return io.EOF
+	}
+	proto.Merge(m.(proto.Message), s.responses[0])
+	s.responses = s.responses[1:]
+	return nil
+}
+
+func echo(_ context.Context, request *wrapperspb.StringValue) ([]proto.Message, error) {
+	return []proto.Message{wrapperspb.String("hello " + request.GetValue())}, nil
+}
+
+func newTestSpec(method string, serverStreaming bool) *routerPkg.GrpcSpec {
+	desc := (&wrapperspb.StringValue{}).ProtoReflect().Descriptor()
+	return &routerPkg.GrpcSpec{
+		RequestDesc:     desc,
+		ResponseDesc:    desc,
+		Service:         "test.Service",
+		Method:          method,
+		ServerStreaming: serverStreaming,
+	}
+}
+
+func newTestEndpoint(t *testing.T, conf *ConfigHTTP, client *testClient, routes ...*routerPkg.Route) *ProxyEndpoint {
+	t.Helper()
+
+	router, err := routerPkg.NewRouterWithRoutes(routes)
+	require.NoError(t, err)
+
+	methods := map[string]*routerPkg.GrpcSpec{
+		testEchoPath:  newTestSpec("Echo", false),
+		testWatchPath: newTestSpec("Watch", true),
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	encoder := jsonencoder.New(&jsonencoder.Config{}, protoregistry.GlobalTypes)
+	endpoint, err := NewProxyEndpoint(logger, conf, router, methods, client, encoder, nil, nil)
+	require.NoError(t, err)
+	return endpoint
+}
+
+func newRPCEndpoint(t *testing.T, client *testClient) *ProxyEndpoint {
+	t.Helper()
+	return newTestEndpoint(t, &ConfigHTTP{RPC: &RPCConfig{GRPCWeb: true, Connect: true}}, client)
+}
+
+type testFrame struct {
+	flags byte
+	data  []byte
+}
+
+func readFrames(t *testing.T, body []byte) []testFrame {
+	t.Helper()
+
+	var frames []testFrame
+	for len(body) > 0 {
+		require.GreaterOrEqual(t, len(body), envelopeHeaderSize)
+		size := int(binary.BigEndian.Uint32(body[1:envelopeHeaderSize]))
+		require.GreaterOrEqual(t, len(body), envelopeHeaderSize+size)
+		frames = append(frames, testFrame{flags: body[0], data: body[envelopeHeaderSize : envelopeHeaderSize+size]})
+		body = body[envelopeHeaderSize+size:]
+	}
+	return frames
+}
+
+func marshalString(t *testing.T, value string) []byte {
+	t.Helper()
+	data, err := proto.Marshal(wrapperspb.String(value))
+	require.NoError(t, err)
+	return data
+}
+
+func unmarshalString(t *testing.T, data []byte) string {
+	t.Helper()
+	msg := &wrapperspb.StringValue{}
+	require.NoError(t, proto.Unmarshal(data, msg))
+	return msg.GetValue()
+}
+
+func serve(endpoint *ProxyEndpoint, method, target, contentType string, body []byte, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, bytes.NewReader(body))
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	if contentType != "" {
+		r.Header.Set(headerContentType, contentType)
+	}
+	w := httptest.NewRecorder()
+	endpoint.ServeHTTP(w, r)
+	return w
+}
+
+func TestMatchRPC(t *testing.T) {
+	connectVersion := http.Header{headerConnectProtoVersion: []string{"1"}}
+	tests := []struct {
+		name        string
+		conf        *RPCConfig
+		method      string
+		target      string
+		contentType string
+		header      http.Header
+		matched     bool
+		protocol    rpcProtocol
+		json        bool
+	}{
+		{"grpc-web", &RPCConfig{GRPCWeb: true}, http.MethodPost, testEchoPath, "application/grpc-web+proto", nil, true, protocolGRPCWeb, false},
+		{"grpc-web-text", &RPCConfig{GRPCWeb: true}, http.MethodPost, testEchoPath, "application/grpc-web-text", nil, true,
+			protocolGRPCWebText, false},
+		{"grpc-web disabled", &RPCConfig{Connect: true}, http.MethodPost, testEchoPath, "application/grpc-web", nil, false, 0, false},
+		{"connect stream", &RPCConfig{Connect: true}, http.MethodPost, testWatchPath, "application/connect+json", nil, true,
+			protocolConnectStream, true},
+		{"connect unary", &RPCConfig{Connect: true}, http.MethodPost, testEchoPath, "application/json", connectVersion, true,
+			protocolConnectUnary, true},
+		{"connect unary proto", &RPCConfig{Connect: true}, http.MethodPost, testEchoPath, "application/proto", connectVersion, true,
+			protocolConnectUnary, false},
+		{"json without protocol version", &RPCConfig{Connect: true}, http.MethodPost, testEchoPath, "application/json", nil, false, 0,
+			false},
+		{"connect get", &RPCConfig{Connect: true}, http.MethodGet, testEchoPath + "?connect=v1&encoding=json", "", nil, true,
+			protocolConnectUnary, true},
+		{"get without connect", &RPCConfig{Connect: true}, http.MethodGet, testEchoPath, "", nil, false, 0, false},
+		{"unknown method", &RPCConfig{GRPCWeb: true}, http.MethodPost, "/test.Service/Unknown", "application/grpc-web", nil, false, 0,
+			false},
+		{"disabled", nil, http.MethodPost, testEchoPath, "application/grpc-web", nil, false, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			endpoint := newTestEndpoint(t, &ConfigHTTP{RPC: test.conf}, &testClient{handle: echo})
+			r := httptest.NewRequest(test.method, test.target, nil)
+			for name, values := range test.header {
+				r.Header[name] = values
+			}
+			if test.contentType != "" {
+				r.Header.Set(headerContentType, test.contentType)
+			}
+
+			call, ok := endpoint.matchRPC(r)
+			require.Equal(t, test.matched, ok)
+			if ok {
+				require.Equal(t, test.protocol, call.protocol)
+				require.Equal(t, test.json, call.json)
+			}
+		})
+	}
+}
+
+func TestRPCPrecedence(t *testing.T) {
+	conf := &ConfigHTTP{RPC: &RPCConfig{Connect: true}}
+	route := routerPkg.NewRoute(testEchoPath, "*", routerPkg.POST, newTestSpec("Echo", false))
+	endpoint := newTestEndpoint(t, conf, &testClient{handle: echo}, route)
+
+	w := serve(endpoint, http.MethodPost, testEchoPath, ContentTypeJSON, []byte(`"REST"`), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `"hello REST"`, w.Body.String())
+	require.Equal(t, headerAccept, w.Header().Get(headerVary), "request without protocol version is served by REST route")
+
+	w = serve(endpoint, http.MethodPost, testEchoPath, ContentTypeJSON, []byte(`"Connect"`),
+		http.Header{headerConnectProtoVersion: []string{"1"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `"hello Connect"`, w.Body.String())
+	require.Empty(t, w.Header().Get(headerVary), "request with protocol version is served by Connect")
+}
+
+func TestGRPCWeb(t *testing.T) {
+	client := &testClient{handle: echo, trailer: metadata.Pairs("x-trace", "abc", "x-data-bin", "\x00\x01")}
+	endpoint := newRPCEndpoint(t, client)
+
+	w := serve(endpoint, http.MethodPost, testEchoPath, "application/grpc-web", encodeEnvelope(0, marshalString(t, "web")), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, contentTypeGRPCWebProto, w.Header().Get(headerContentType))
+
+	frames := readFrames(t, w.Body.Bytes())
+	require.Len(t, frames, 2)
+	require.Equal(t, byte(0), frames[0].flags)
+	require.Equal(t, "hello web", unmarshalString(t, frames[0].data))
+
+	require.Equal(t, byte(flagGRPCWebTrailer), frames[1].flags)
+	trailer := string(frames[1].data)
+	require.Contains(t, trailer, "grpc-status: 0\r\n")
+	require.Contains(t, trailer, "x-trace: abc\r\n")
+	require.Contains(t, trailer, "x-data-bin: AAE\r\n")
+	require.NotContains(t, trailer, "grpc-message")
+}
+
+func TestGRPCWebText(t *testing.T) {
+	endpoint := newRPCEndpoint(t, &testClient{handle: echo})
+
+	body := []byte(base64.StdEncoding.EncodeToString(encodeEnvelope(0, marshalString(t, "text"))))
+	w := serve(endpoint, http.MethodPost, testEchoPath, "application/grpc-web-text", body, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, contentTypeGRPCWebTextPB, w.Header().Get(headerContentType))
+
+	// every frame is encoded separately, so padding may appear in the middle of the body
+	message := base64.StdEncoding.EncodeToString(encodeEnvelope(0, marshalString(t, "hello text")))
+	require.True(t, strings.HasPrefix(w.Body.String(), message))
+	trailer, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(w.Body.String(), message))
+	require.NoError(t, err)
+
+	frames := readFrames(t, trailer)
+	require.Len(t, frames, 1)
+	require.Equal(t, byte(flagGRPCWebTrailer), frames[0].flags)
+	require.Contains(t, string(frames[0].data), "grpc-status: 0\r\n")
+
+	w = serve(endpoint, http.MethodPost, testEchoPath, "application/grpc-web-text", []byte("not base64!"), nil)
+	trailer, err = base64.StdEncoding.DecodeString(w.Body.String())
+	require.NoError(t, err)
+	frames = readFrames(t, trailer)
+	require.Len(t, frames, 1)
+	require.Contains(t, string(frames[0].data), "grpc-status: 3\r\n")
+}
+
+func TestGRPCWebError(t *testing.T) {
+	client := &testClient{handle: func(context.Context, *wrapperspb.StringValue) ([]proto.Message, error) {
+		return nil, grpcStatus.Error(codes.NotFound, "user 100% not found")
+	}}
+	endpoint := newRPCEndpoint(t, client)
+
+	w := serve(endpoint, http.MethodPost, testEchoPath, "application/grpc-web", encodeEnvelope(0, marshalString(t, "web")), nil)
+	require.Equal(t, http.StatusOK, w.Code, "status is sent in the trailer frame")
+
+	frames := readFrames(t, w.Body.Bytes())
+	require.Len(t, frames, 1)
+	require.Equal(t, byte(flagGRPCWebTrailer), frames[0].flags)
+	require.Contains(t, string(frames[0].data), "grpc-status: 5\r\n")
+	require.Contains(t, string(frames[0].data), "grpc-message: user 100%25 not found\r\n")
+}
+
+func TestRPCEnvelope(t *testing.T) {
+	endpoint := newRPCEndpoint(t, &testClient{handle: echo})
+	data := marshalString(t, "web")
+
+	tests := []struct {
+		name string
+		body []byte
+		code codes.Code
+	}{
+		{"valid", encodeEnvelope(0, data), codes.OK},
+		{"empty message", encodeEnvelope(0, nil), codes.OK},
+		{"short header", []byte{0, 0, 0}, codes.InvalidArgument},
+		{"length exceeds body", encodeEnvelope(0, data)[:envelopeHeaderSize+1], codes.InvalidArgument},
+		{"trailing data", append(encodeEnvelope(0, data), 0), codes.InvalidArgument},
+		{"compressed", encodeEnvelope(flagCompressed, data), codes.Unimplemented},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := serve(endpoint, http.MethodPost, testEchoPath, "application/grpc-web", test.body, nil)
+			frames := readFrames(t, w.Body.Bytes())
+			require.NotEmpty(t, frames)
+			require.Contains(t, string(frames[len(frames)-1].data), "grpc-status: "+strconv.Itoa(int(test.code))+"\r\n")
+		})
+	}
+}
+
+func TestConnectUnary(t *testing.T) {
+	client := &testClient{handle: echo, header: metadata.Pairs("x-user", "john"), trailer: metadata.Pairs("x-trace", "abc")}
+	endpoint := newRPCEndpoint(t, client)
+	version := http.Header{headerConnectProtoVersion: []string{"1"}}
+
+	w := serve(endpoint, http.MethodPost, testEchoPath, ContentTypeJSON, []byte(`"json"`), version)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, ContentTypeJSON, w.Header().Get(headerContentType))
+	require.Equal(t, "abc", w.Header().Get("Trailer-X-Trace"))
+	require.JSONEq(t, `"hello json"`, w.Body.String())
+
+	w = serve(endpoint, http.MethodPost, testEchoPath, contentTypeProto, marshalString(t, "proto"), version)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, contentTypeProto, w.Header().Get(headerContentType))
+	require.Equal(t, "hello proto", unmarshalString(t, w.Body.Bytes()))
+
+	query := url.Values{"connect": {"v1"}, "encoding": {"json"}, "message": {`"get"`}}
+	w = serve(endpoint, http.MethodGet, testEchoPath+"?"+query.Encode(), "", nil, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `"hello get"`, w.Body.String())
+
+	message := base64.URLEncoding.EncodeToString(marshalString(t, "base64"))
+	query = url.Values{"connect": {"v1"}, "encoding": {"proto"}, "base64": {"1"}, "message": {message}}
+	w = serve(endpoint, http.MethodGet, testEchoPath+"?"+query.Encode(), "", nil, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "hello base64", unmarshalString(t, w.Body.Bytes()))
+
+	query = url.Values{"connect": {"v1"}, "encoding": {"json"}, "message": {`"get"`}, "compression": {"gzip"}}
+	w = serve(endpoint, http.MethodGet, testEchoPath+"?"+query.Encode(), "", nil, nil)
+	require.Equal(t, http.StatusNotImplemented, w.Code)
+	require.JSONEq(t, `{"code":"unimplemented","message":"gzip: unsupported content encoding"}`, w.Body.String())
+}
+
+func TestConnectUnaryError(t *testing.T) {
+	client := &testClient{handle: func(context.Context, *wrapperspb.StringValue) ([]proto.Message, error) {
+		return nil, grpcStatus.Error(codes.NotFound, "user not found")
+	}}
+	endpoint := newRPCEndpoint(t, client)
+
+	w := serve(endpoint, http.MethodPost, testEchoPath, ContentTypeJSON, []byte(`"json"`),
+		http.Header{headerConnectProtoVersion: []string{"1"}})
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Equal(t, ContentTypeJSON, w.Header().Get(headerContentType))
+	require.JSONEq(t, `{"code":"not_found","message":"user not found"}`, w.Body.String())
+
+	w = serve(endpoint, http.MethodPost, testWatchPath, ContentTypeJSON, []byte(`"json"`),
+		http.Header{headerConnectProtoVersion: []string{"1"}})
+	require.Equal(t, http.StatusNotImplemented, w.Code, "streaming methods need streaming protocol")
+}
+
+func TestConnectStream(t *testing.T) {
+	client := &testClient{
+		handle: func(_ context.Context, request *wrapperspb.StringValue) ([]proto.Message, error) {
+			return []proto.Message{wrapperspb.String("first " + request.GetValue()), wrapperspb.String("second")},
+				grpcStatus.Error(codes.Unavailable, "backend is gone")
+		},
+		trailer: metadata.Pairs("x-trace", "abc"),
+	}
+	endpoint := newRPCEndpoint(t, client)
+
+	w := serve(endpoint, http.MethodPost, testWatchPath, contentTypeConnectJSON, encodeEnvelope(0, []byte(`"stream"`)), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, contentTypeConnectJSON, w.Header().Get(headerContentType))
+
+	frames := readFrames(t, w.Body.Bytes())
+	require.Len(t, frames, 3)
+	require.JSONEq(t, `"first stream"`, string(frames[0].data))
+	require.JSONEq(t, `"second"`, string(frames[1].data))
+
+	require.Equal(t, byte(flagConnectEndStream), frames[2].flags)
+	require.JSONEq(t, `{
+		"error": {"code": "unavailable", "message": "backend is gone"},
+		"metadata": {"x-trace": ["abc"]}
+	}`, string(frames[2].data))
+
+	client.handle = echo
+	w = serve(endpoint, http.MethodPost, testWatchPath, contentTypeConnectJSON, encodeEnvelope(0, []byte(`"stream"`)), nil)
+	frames = readFrames(t, w.Body.Bytes())
+	require.Len(t, frames, 2)
+	require.JSONEq(t, `{"metadata": {"x-trace": ["abc"]}}`, string(frames[1].data), "successful stream has no error")
+}
+
+func TestRPCTimeout(t *testing.T) {
+	var deadline time.Time
+	client := &testClient{handle: func(ctx context.Context, request *wrapperspb.StringValue) ([]proto.Message, error) {
+		deadline, _ = ctx.Deadline()
+		return echo(ctx, request)
+	}}
+	endpoint := newRPCEndpoint(t, client)
+	body := encodeEnvelope(0, marshalString(t, "web"))
+
+	start := time.Now()
+	serve(endpoint, http.MethodPost, testEchoPath, "application/grpc-web", body, http.Header{headerGRPCTimeout: []string{"1H"}})
+	require.WithinDuration(t, start.Add(time.Hour), deadline, time.Minute)
+
+	serve(endpoint, http.MethodPost, testWatchPath, contentTypeConnectProto, body, http.Header{headerConnectTimeout: []string{"60000"}})
+	require.WithinDuration(t, start.Add(time.Minute), deadline, 10*time.Second)
+
+	w := serve(endpoint, http.MethodPost, testEchoPath, "application/grpc-web", body, http.Header{headerGRPCTimeout: []string{"1x"}})
+	frames := readFrames(t, w.Body.Bytes())
+	require.Len(t, frames, 1)
+	require.Contains(t, string(frames[0].data), "grpc-status: 3\r\n")
+}
+
+func TestParseGRPCTimeout(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+		valid    bool
+	}{
+		{"1H", time.Hour, true},
+		{"2M", 2 * time.Minute, true},
+		{"5S", 5 * time.Second, true},
+		{"100m", 100 * time.Millisecond, true},
+		{"10u", 10 * time.Microsecond, true},
+		{"3n", 3 * time.Nanosecond, true},
+		{"", 0, false},
+		{"S", 0, false},
+		{"10", 0, false},
+		{"10s", 0, false},
+		{"-1S", 0, false},
+		{"99999999999S", 0, false},
+	}
+
+	for _, test := range tests {
+		timeout, err := parseGRPCTimeout(test.value)
+		if !test.valid {
+			require.Error(t, err, test.value)
+			continue
+		}
+		require.NoError(t, err, test.value)
+		require.Equal(t, test.expected, timeout, test.value)
+	}
+}
+
+func TestGetConnectCode(t *testing.T) {
+	tests := map[codes.Code]string{
+		codes.Canceled:           "canceled",
+		codes.InvalidArgument:    "invalid_argument",
+		codes.DeadlineExceeded:   "deadline_exceeded",
+		codes.NotFound:           "not_found",
+		codes.ResourceExhausted:  "resource_exhausted",
+		codes.FailedPrecondition: "failed_precondition",
+		codes.DataLoss:           "data_loss",
+		codes.Unauthenticated:    "unauthenticated",
+		codes.OK:                 "unknown",
+		codes.Code(100):          "unknown",
+	}
+
+	for code, name := range tests {
+		require.Equal(t, name, getConnectCode(code), code.String())
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+package transport
+
+import (
+	"strconv"
+	"strings"
+
+	routerPkg "github.com/eset/grpc-rest-proxy/pkg/service/router"
+	"github.com/eset/grpc-rest-proxy/pkg/service/transformer"
+
+	jErrors "github.com/juju/errors"
+
+	"google.golang.org/grpc/codes"
+)
+
+// StatusCodesConfig overrides default mapping of gRPC codes to HTTP status codes. Codes are addressed by name,
+// e.g. FailedPrecondition or FAILED_PRECONDITION, or by number. Mapping of OK code changes status of successful
+// responses. Informational 1xx status codes cannot be used as they do not complete the response.
+type StatusCodesConfig struct {
+	Codes  map[string]int            `mapstructure:"codes" validate:"dive,gte=200,lte=599"`
+	Routes []*StatusCodesRouteConfig `mapstructure:"routes" validate:"dive"`
+}
+
+// StatusCodesRouteConfig overrides mapping for route pattern or gRPC method, e.g. /user.v1.UserService/CreateUser.
+type StatusCodesRouteConfig struct {
+	Route string         `mapstructure:"route" validate:"required"`
+	Codes map[string]int `mapstructure:"codes" validate:"dive,gte=200,lte=599"`
+}
+
+type codeMapping map[codes.Code]int
+
+type statusCodes struct {
+	codes  codeMapping
+	routes map[string]codeMapping
+}
+
+func newStatusCodes(conf *StatusCodesConfig) (*statusCodes, error) {
+	if conf == nil {
+		return nil, nil
+	}
+
+	global, err := newCodeMapping(conf.Codes)
+	if err != nil {
+		return nil, jErrors.Trace(err)
+	}
+
+	s := &statusCodes{codes: global, routes: make(map[string]codeMapping, len(conf.Routes))}
+	for _, routeConf := range conf.Routes {
+		if _, ok := s.routes[routeConf.Route]; ok {
+			return nil, jErrors.Errorf("duplicate status codes of route %s", routeConf.Route)
+		}
+		s.routes[routeConf.Route], err = newCodeMapping(routeConf.Codes)
+		if err != nil {
+			return nil, jErrors.Annotatef(err, "status codes of route %s", routeConf.Route)
+		}
+	}
+	return s, nil
+}
+
+func newCodeMapping(httpCodes map[string]int) (codeMapping, error) {
+	mapping := make(codeMapping, len(httpCodes))
+	for name, httpCode := range httpCodes {
+		code, err := parseCode(name)
+		if err != nil {
+			return nil, jErrors.Trace(err)
+		}
+		mapping[code] = httpCode
+	}
+	return mapping, nil
+}
+
+// parseCode parses gRPC code by its name regardless of case and underscores, names are lowercased
+// by configuration loader. Number of the code is accepted as well.
+func parseCode(name string) (codes.Code, error) {
+	if number, err := strconv.ParseUint(name, 10, 32); err == nil {
+		if code := codes.Code(number); code <= codes.Unauthenticated {
+			return code, nil
+		}
+		return codes.Unknown, jErrors.Errorf("unknown gRPC code %s", name)
+	}
+
+	normalized := strings.ToLower(strings.ReplaceAll(name, "_", ""))
+	for code := codes.OK; code <= codes.Unauthenticated; code++ {
+		if strings.ToLower(code.String()) == normalized {
+			return code, nil
+		}
+	}
+	return codes.Unknown, jErrors.Errorf("unknown gRPC code %s", name)
+}
+
+// httpCode returns HTTP status code of gRPC code for matched route. Mapping of the route pattern takes
+// precedence over mapping of the gRPC method, which takes precedence over global mapping.
+func (s *statusCodes) httpCode(route *routerPkg.Match, code codes.Code) int {
+	if s != nil {
+		for _, key := range []string{route.Pattern, route.GrpcSpec.FullPath()} {
+			if httpCode, ok := s.routes[key][code]; ok {
+				return httpCode
+			}
+		}
+		if httpCode, ok := s.codes[code]; ok {
+			return httpCode
+		}
+	}
+	return transformer.GetHTTPStatusCode(code)
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2024 ESET
+// See LICENSE file for redistribution.
+
+package transport
+
+import (
+	"net/http"
+	"testing"
+
+	routerPkg "github.com/eset/grpc-rest-proxy/pkg/service/router"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestParseCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected codes.Code
+		valid    bool
+	}{
+		{"OK", codes.OK, true},
+		{"NotFound", codes.NotFound, true},
+		{"notfound", codes.NotFound, true},
+		{"FAILED_PRECONDITION", codes.FailedPrecondition, true},
+		{"unauthenticated", codes.Unauthenticated, true},
+		{"0", codes.OK, true},
+		{"5", codes.NotFound, true},
+		{"16", codes.Unauthenticated, true},
+		{"17", codes.Unknown, false},
+		{"-1", codes.Unknown, false},
+		{"NotExisting", codes.Unknown, false},
+		{"", codes.Unknown, false},
+	}
+
+	for _, test := range tests {
+		code, err := parseCode(test.name)
+		if !test.valid {
+			require.Error(t, err, test.name)
+			continue
+		}
+		require.NoError(t, err, test.name)
+		require.Equal(t, test.expected, code, test.name)
+	}
+}
+
+func TestNewStatusCodes(t *testing.T) {
+	statusCodes, err := newStatusCodes(nil)
+	require.NoError(t, err)
+	require.Nil(t, statusCodes)
+
+	_, err = newStatusCodes(&StatusCodesConfig{Codes: map[string]int{"Unknwn": 500}})
+	require.ErrorContains(t, err, "unknown gRPC code Unknwn")
+
+	_, err = newStatusCodes(&StatusCodesConfig{Routes: []*StatusCodesRouteConfig{
+		{Route: "/api/user/{username}", Codes: map[string]int{"99": 404}},
+	}})
+	require.ErrorContains(t, err, "status codes of route /api/user/{username}")
+
+	_, err = newStatusCodes(&StatusCodesConfig{Routes: []*StatusCodesRouteConfig{
+		{Route: "/api/user/{username}"},
+		{Route: "/api/user/{username}"},
+	}})
+	require.ErrorContains(t, err, "duplicate status codes of route /api/user/{username}")
+}
+
+func TestStatusCodesValidation(t *testing.T) {
+	validate := validator.New()
+	require.NoError(t, validate.Struct(&StatusCodesConfig{Codes: map[string]int{"OK": 201, "Internal": 599}}))
+	require.Error(t, validate.Struct(&StatusCodesConfig{Codes: map[string]int{"OK": 102}}), "informational status")
+	require.Error(t, validate.Struct(&StatusCodesConfig{Codes: map[string]int{"Internal": 600}}))
+	require.Error(t, validate.Struct(&StatusCodesConfig{Routes: []*StatusCodesRouteConfig{
+		{Route: "/api/user/{username}", Codes: map[string]int{"OK": 100}},
+	}}))
+}
+
+func TestStatusCodesPrecedence(t *testing.T) {
+	mapping, err := newStatusCodes(&StatusCodesConfig{
+		Codes: map[string]int{"NotFound": 410, "OK": 202},
+		Routes: []*StatusCodesRouteConfig{
+			{Route: "/api/user/{username}", Codes: map[string]int{"NOT_FOUND": 404}},
+			{Route: "/test.Service/Echo", Codes: map[string]int{"NotFound": 400, "AlreadyExists": 422, "OK": 201}},
+		},
+	})
+	require.NoError(t, err)
+
+	spec := &routerPkg.GrpcSpec{Service: "/test.Service", Method: "Echo"}
+	match := &routerPkg.Match{Pattern: "/api/user/{username}", GrpcSpec: spec}
+	require.Equal(t, http.StatusNotFound, mapping.httpCode(match, codes.NotFound), "route pattern takes precedence")
+	require.Equal(t, http.StatusUnprocessableEntity, mapping.httpCode(match, codes.AlreadyExists), "gRPC method is used without pattern")
+	require.Equal(t, http.StatusCreated, mapping.httpCode(match, codes.OK))
+	require.Equal(t, http.StatusServiceUnavailable, mapping.httpCode(match, codes.Unavailable), "default mapping")
+
+	other := &routerPkg.Match{Pattern: "/api/other", GrpcSpec: &routerPkg.GrpcSpec{Service: "/test.Service", Method: "Other"}}
+	require.Equal(t, http.StatusGone, mapping.httpCode(other, codes.NotFound), "global mapping")
+	require.Equal(t, http.StatusAccepted, mapping.httpCode(other, codes.OK))
+	require.Equal(t, http.StatusConflict, mapping.httpCode(other, codes.AlreadyExists))
+
+	var noStatusCodes *statusCodes
+	require.Equal(t, http.StatusNotFound, noStatusCodes.httpCode(other, codes.NotFound))
+}
@@ -19,10 +19,13 @@ type Logger interface {
 	ErrorContext(ctx context.Context, msg string, args ...any)
 }
 
-func NewHandler(reloader *EndpointReloader) http.Handler {
+// NewHandler mounts the proxy at all paths except the health status endpoint, which is disabled when its path is empty.
+func NewHandler(reloader *EndpointReloader, statusPath string) http.Handler {
 	routes := chi.NewRouter()
 	routes.Handle("/*", reloader)
-	routes.Get("/status", handleStatus)
+	if statusPath != "" {
+		routes.Get(statusPath, handleStatus)
+	}
 	return routes
 }
 